@@ -0,0 +1,121 @@
+package verifysfv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// VerifyArchive verifies the checksums in sfv against the members of the zip
+// or tar archive at archivePath without extracting it. Filenames are matched
+// against member names, so the manifest must list paths relative to the root
+// of the archive. Checksums without a matching member are reported as
+// missing. Zip archives are recognized by their .zip extension, anything else
+// is read as a tar archive, optionally gzipped.
+func VerifyArchive(archivePath string, sfv *SFV, polynomial uint32) (Summary, error) {
+	var summary Summary
+	polynomial = sfv.polynomial(polynomial)
+	wanted := map[string][]Checksum{}
+	for _, c := range sfv.Checksums {
+		name := memberName(c.Filename)
+		wanted[name] = append(wanted[name], c)
+	}
+	// members listed more than once are hashed once and compared against
+	// every listed checksum
+	verify := func(name string, r io.Reader) {
+		checksums := wanted[name]
+		if len(checksums) == 0 {
+			return
+		}
+		first := checksums[0].verifyReader(r, polynomial)
+		summary.Add(first)
+		for _, c := range checksums[1:] {
+			summary.Add(c.sameContent(first))
+		}
+		delete(wanted, name)
+	}
+
+	var err error
+	if strings.EqualFold(path.Ext(archivePath), ".zip") {
+		err = walkZip(archivePath, verify)
+	} else {
+		err = walkTar(archivePath, verify)
+	}
+	if err != nil {
+		return summary, err
+	}
+	for _, c := range sfv.Checksums {
+		if _, ok := wanted[memberName(c.Filename)]; ok {
+			err := &fs.PathError{Op: "open", Path: archivePath + ":" + c.Filename, Err: fs.ErrNotExist}
+			summary.Add(c.result(nil, 0, 0, err))
+		}
+	}
+	return summary, nil
+}
+
+// memberName normalizes a filename or archive member name for matching, so
+// that e.g. "./dir//file" matches "dir/file".
+func memberName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// walkZip calls verify with the name and content of every regular file in the
+// zip archive at archivePath.
+func walkZip(archivePath string, verify func(name string, r io.Reader)) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		verify(memberName(f.Name), rc)
+		rc.Close()
+	}
+	return nil
+}
+
+// walkTar is like walkZip for tar archives, which may be gzipped.
+func walkTar(archivePath string, verify func(name string, r io.Reader)) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		verify(memberName(hdr.Name), tr)
+	}
+}
@@ -0,0 +1,102 @@
+package verifysfv
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// archiveMembers are written to the archives verified by TestVerifyArchive.
+var archiveMembers = []struct{ name, content string }{
+	{"foo", "foo\n"},
+	{"./sub/bar", "baz\n"},
+}
+
+func writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, m := range archiveMembers {
+		f, err := zw.Create(m.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, m.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		return err
+	}
+	for _, m := range archiveMembers {
+		hdr := &tar.Header{Name: m.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(m.content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, m.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func TestVerifyArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sfv := &SFV{Checksums: []Checksum{
+		{Filename: "foo", CRC32: 0x9626347b},
+		{Filename: "sub/bar", CRC32: 0xfb1d06c8},
+		{Filename: "missing", CRC32: 0x12345678},
+		{Filename: "./foo", CRC32: 0x9626347b},
+	}}
+	for name, write := range map[string]func(io.Writer) error{
+		"release.zip":    writeZip,
+		"release.tar.gz": writeTarGz,
+	} {
+		archive := filepath.Join(dir, name)
+		f, err := os.Create(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		summary, err := VerifyArchive(archive, sfv, crc32.Castagnoli)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(summary.OK) != 2 || len(summary.Corrupt) != 1 || len(summary.Missing) != 1 {
+			t.Fatalf("Expected 2 ok, 1 missing and 1 corrupt in %s, got %s", name, summary)
+		}
+		if expected := "sub/bar"; summary.Corrupt[0].Filename != expected {
+			t.Fatalf("Expected %q, got %q", expected, summary.Corrupt[0].Filename)
+		}
+		if expected := "missing"; summary.Missing[0].Filename != expected {
+			t.Fatalf("Expected %q, got %q", expected, summary.Missing[0].Filename)
+		}
+	}
+
+	if _, err := VerifyArchive(filepath.Join(dir, "nonexistent.zip"), sfv, crc32.Castagnoli); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing archive error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package verifysfv
+
+import (
+	"encoding/json"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache remembers the files that verified OK along with their size and
+// modification time, so that repeated scans of a large tree only read the
+// files that changed since. An entry is only used if the file still has the
+// same size, modification time and expected checksum, and is dropped as soon
+// as any of them differ. A Cache is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is what a Cache records of a file that verified OK.
+type cacheEntry struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	Algorithm  string    `json:"algorithm"`
+	Polynomial uint32    `json:"polynomial,omitempty"`
+	Digest     string    `json:"digest"`
+}
+
+// NewCache returns an empty Cache.
+func NewCache() *Cache {
+	return &Cache{entries: map[string]cacheEntry{}}
+}
+
+// LoadCache reads a Cache written by Cache.Save. A missing file yields an
+// empty Cache, as on the first scan.
+func LoadCache(path string) (*Cache, error) {
+	cache := NewCache()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &cache.entries); err != nil {
+		return nil, &fs.PathError{Op: "load cache", Path: path, Err: err}
+	}
+	if cache.entries == nil {
+		cache.entries = map[string]cacheEntry{}
+	}
+	return cache, nil
+}
+
+// Save writes the cache to path as json, replacing the file atomically so
+// that an interrupted save doesn't lose the previous cache.
+func (cache *Cache) Save(path string) error {
+	cache.mu.Lock()
+	b, err := json.Marshal(cache.entries)
+	cache.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Ignore error, it's gone after the rename
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close() // Ignore error
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Len returns the number of files in the cache.
+func (cache *Cache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return len(cache.entries)
+}
+
+// cacheEntry returns what the cache should hold for c once it verified OK with
+// polynomial while its file had the given info.
+func (c *Checksum) cacheEntry(info fs.FileInfo, polynomial uint32) cacheEntry {
+	entry := cacheEntry{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Algorithm: c.Algorithm.String(),
+		Digest:    c.ExpectedHex(),
+	}
+	if c.Algorithm == CRC32 {
+		entry.Polynomial = polynomial
+	}
+	return entry
+}
+
+// cacheKey returns the absolute path of c, so that the cache is independent
+// of the working directory.
+func (c *Checksum) cacheKey() string {
+	if abs, err := filepath.Abs(c.Path); err == nil {
+		return abs
+	}
+	return c.Path
+}
+
+// lookup reports whether the cache holds c with the size and modification
+// time of info, dropping the entry if the file has changed since.
+func (cache *Cache) lookup(c *Checksum, info fs.FileInfo, polynomial uint32) bool {
+	key := c.cacheKey()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry, ok := cache.entries[key]
+	if !ok {
+		return false
+	}
+	expected := c.cacheEntry(info, polynomial)
+	if entry.Size != expected.Size || !entry.ModTime.Equal(expected.ModTime) ||
+		entry.Algorithm != expected.Algorithm || entry.Polynomial != expected.Polynomial ||
+		entry.Digest != expected.Digest {
+		delete(cache.entries, key)
+		return false
+	}
+	return true
+}
+
+// store records that c verified OK with polynomial while its file had the
+// given info.
+func (cache *Cache) store(c *Checksum, info fs.FileInfo, polynomial uint32) {
+	entry := c.cacheEntry(info, polynomial)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[c.cacheKey()] = entry
+}
+
+// forget drops c from the cache, e.g. because it failed to verify.
+func (cache *Cache) forget(c *Checksum) {
+	key := c.cacheKey()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.entries, key)
+}
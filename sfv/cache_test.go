@@ -0,0 +1,104 @@
+package verifysfv
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	cache := NewCache()
+	opts := VerifyOptions{Polynomial: crc32.Castagnoli, Cache: cache}
+	verify := func() (read, cached int) {
+		report := &VerifyReport{}
+		opts.Report = report
+		if _, err := sfv.VerifyWithOptions(opts); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Summary.OK) != 2 {
+			t.Fatalf("Expected 2 ok, got %s", report.Summary)
+		}
+		for _, r := range report.Results {
+			if r.Cached {
+				cached++
+			} else {
+				read++
+			}
+		}
+		return read, cached
+	}
+
+	// miss: both files are read and recorded
+	if read, cached := verify(); read != 2 || cached != 0 {
+		t.Fatalf("Expected 2 files read, got %d read and %d cached", read, cached)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Expected %d, got %d", 2, cache.Len())
+	}
+
+	// hit: neither file is read again, even after a save and load
+	path := filepath.Join(os.TempDir(), filepath.Base(sfv.Path)+".cache")
+	defer os.Remove(path) // Ignore error
+	if err := cache.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if cache, err = LoadCache(path); err != nil {
+		t.Fatal(err)
+	}
+	opts.Cache = cache
+	if read, cached := verify(); read != 0 || cached != 2 {
+		t.Fatalf("Expected 2 files cached, got %d read and %d cached", read, cached)
+	}
+
+	// invalidation: a file whose modification time changed is read again
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(sfv.Checksums[0].Path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if read, cached := verify(); read != 1 || cached != 1 {
+		t.Fatalf("Expected 1 file read, got %d read and %d cached", read, cached)
+	}
+
+	// corrupt files are dropped from the cache
+	if err := ioutil.WriteFile(sfv.Checksums[1].Path, []byte("baz\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if summary, _ := sfv.VerifyWithOptions(opts); len(summary.Corrupt) != 1 {
+		t.Fatalf("Expected 1 corrupt, got %s", summary)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("Expected %d, got %d", 1, cache.Len())
+	}
+	// a different polynomial is a miss
+	opts.Polynomial = crc32.IEEE
+	if summary, _ := sfv.VerifyWithOptions(opts); len(summary.OK) != 0 {
+		t.Fatalf("Expected no ok, got %s", summary)
+	}
+}
+
+func TestLoadCacheMissing(t *testing.T) {
+	cache, err := LoadCache(filepath.Join(os.TempDir(), "gosfv-missing.cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("Expected %d, got %d", 0, cache.Len())
+	}
+}
@@ -0,0 +1,59 @@
+package verifysfv
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80-0x9F of Windows-1252 to runes. The other
+// bytes map to the rune of the same value, as in ISO-8859-1. Unassigned bytes
+// map to the corresponding C1 control, like Windows does.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// decodeCharset returns a reader transcoding r from charset to UTF-8. An empty
+// charset or "utf-8" returns r unchanged.
+func decodeCharset(r io.Reader, charset string) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return r, nil
+	case "windows-1252", "cp1252":
+		return &singleByteReader{r: r, decode: func(b byte) rune {
+			if b >= 0x80 && b < 0xA0 {
+				return windows1252[b-0x80]
+			}
+			return rune(b)
+		}}, nil
+	case "iso-8859-1", "latin1":
+		return &singleByteReader{r: r, decode: func(b byte) rune { return rune(b) }}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %s", charset)
+}
+
+// singleByteReader transcodes a single-byte encoding to UTF-8.
+type singleByteReader struct {
+	r      io.Reader
+	decode func(byte) rune
+	buf    [512]byte
+	out    []byte
+}
+
+func (s *singleByteReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		n, err := s.r.Read(s.buf[:])
+		var enc [utf8.UTFMax]byte
+		for _, b := range s.buf[:n] {
+			s.out = append(s.out, enc[:utf8.EncodeRune(enc[:], s.decode(b))]...)
+		}
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
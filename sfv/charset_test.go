@@ -0,0 +1,41 @@
+package verifysfv
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadWindows1252(t *testing.T) {
+	sfv, err := ReadWithOptions("testdata/windows-1252.sfv", ReadOptions{Charset: "windows-1252"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "café"; sfv.Checksums[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[0].Filename)
+	}
+	if expected := "“quoted”"; sfv.Checksums[1].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[1].Filename)
+	}
+	if ok, err := sfv.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected transcoded filenames to verify, got %v", err)
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	r, err := decodeCharset(strings.NewReader("caf\xe9 \x80"), "iso-8859-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "café \u0080"; string(b) != expected {
+		t.Fatalf("Expected %q, got %q", expected, b)
+	}
+	if _, err := decodeCharset(strings.NewReader(""), "ebcdic"); err == nil {
+		t.Fatal("Expected an error for an unsupported charset")
+	}
+}
@@ -0,0 +1,52 @@
+package verifysfv
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+)
+
+// ChunkSum is the CRC32 of one chunk of a file.
+type ChunkSum struct {
+	Offset int64
+	Length int64
+	CRC32  uint32
+}
+
+// ChunkSums computes the CRC32 of each consecutive chunkSize bytes of the
+// associated file. A whole-file checksum only says that a file is corrupt;
+// comparing the chunk sums against those of a good copy with
+// MismatchedChunks narrows down where.
+func (c *Checksum) ChunkSums(chunkSize int64, polynomial uint32) ([]ChunkSum, error) {
+	f, err := openFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := []ChunkSum{}
+	for offset := int64(0); ; offset += chunkSize {
+		h := crc32.New(crcTable(polynomial))
+		n, err := hashReader(context.Background(), io.LimitReader(f, chunkSize), h)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return sums, nil
+		}
+		sums = append(sums, ChunkSum{Offset: offset, Length: n, CRC32: h.Sum32()})
+	}
+}
+
+// MismatchedChunks returns the chunks of sums that differ from the chunk at
+// the same offset in reference, or that reference lacks, e.g. because one
+// file is truncated. Both must have been computed with the same chunk size.
+func MismatchedChunks(sums, reference []ChunkSum) []ChunkSum {
+	mismatched := []ChunkSum{}
+	for i, s := range sums {
+		if i >= len(reference) || reference[i] != s {
+			mismatched = append(mismatched, s)
+		}
+	}
+	return mismatched
+}
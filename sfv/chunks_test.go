@@ -0,0 +1,52 @@
+package verifysfv
+
+import (
+	"hash/crc32"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestChunkSums(t *testing.T) {
+	good, err := tempFile("foo\nbar\nbaz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(good.Name())
+	bad, err := tempFile("foo\nBAR\nbaz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(bad.Name())
+
+	c := Checksum{Filename: "good", Path: good.Name()}
+	reference, err := c.ChunkSums(4, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reference) != 3 || reference[0].CRC32 != 0x9626347b || reference[2].Length != 3 {
+		t.Fatalf("Expected 3 chunks of 4, 4 and 3 bytes, got %+v", reference)
+	}
+
+	c = Checksum{Filename: "bad", Path: bad.Name()}
+	sums, err := c.ChunkSums(4, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatched := MismatchedChunks(sums, reference)
+	if len(mismatched) != 1 || mismatched[0].Offset != 4 || mismatched[0].Length != 4 {
+		t.Fatalf("Expected bytes 4-8 to mismatch, got %+v", mismatched)
+	}
+	if mismatched := MismatchedChunks(reference, reference[:2]); !reflect.DeepEqual(mismatched, reference[2:]) {
+		t.Fatalf("Expected chunks missing from the reference to mismatch, got %+v", mismatched)
+	}
+
+	c = Checksum{Filename: "good", Path: good.Name()}
+	sums, err = c.ChunkSums(4, uint32(Auto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := crc32.ChecksumIEEE([]byte("foo\n")); sums[0].CRC32 != expected {
+		t.Fatalf("Expected Auto to mean IEEE, %X, got %X", expected, sums[0].CRC32)
+	}
+}
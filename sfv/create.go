@@ -0,0 +1,91 @@
+package verifysfv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// header is written as the first line of generated SFV files.
+const header = "; Generated by verifysfv"
+
+// Create walks dir and writes an SFV manifest containing the CRC32 of every
+// regular file found to w. Filenames are written relative to dir. Existing
+// .sfv files are skipped so that a manifest can be created inside the
+// directory it describes.
+func Create(dir string, w io.Writer, polynomial uint32) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, header); err != nil {
+		return err
+	}
+	err := WalkFiles(dir, func(c Checksum, err error) error {
+		if err != nil {
+			return err
+		}
+		crc, err := c.Compute(polynomial)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(bw, "%s %08X\n", c.Filename, crc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WalkFiles walks dir and calls fn with a Checksum, without a CRC32, for
+// every regular file found, in lexical order, skipping .sfv files like
+// Create. Filenames are relative to dir. Paths that can't be walked are
+// passed to fn with a Checksum holding only the Path and the error; if fn
+// returns nil the walk carries on past them, otherwise it stops and returns
+// fn's error.
+func WalkFiles(dir string, fn func(c Checksum, err error) error) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fn(Checksum{Path: p}, err)
+		}
+		if !info.Mode().IsRegular() || isSFVName(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return fn(Checksum{Path: p}, err)
+		}
+		return fn(Checksum{Filename: filepath.ToSlash(rel), Path: p}, nil)
+	})
+}
+
+// CreateFromList reads newline-delimited paths from r, such as the output of
+// find, and writes an SFV manifest containing the CRC32 of each file to w.
+// Paths are written as given, so relative paths stay relative to the
+// directory the list was produced in. Blank lines are ignored.
+func CreateFromList(r io.Reader, w io.Writer, polynomial uint32) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, header); err != nil {
+		return err
+	}
+	scanner := newLineScanner(r)
+	n := 1
+	for ; scanner.Scan(); n++ {
+		p := scanner.Text()
+		if p == "" {
+			continue
+		}
+		c := Checksum{Filename: filepath.ToSlash(p), Path: p}
+		crc, err := c.Compute(polynomial)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(bw, "%s %08X\n", c.Filename, crc); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return lineError(n, err)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,133 @@
+package verifysfv
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"foo":         "foo\n",
+		"sub/bar baz": "bar\n",
+		"old.sfv":     "; should be skipped\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := Create(dir, &b, crc32.Castagnoli); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; Generated by verifysfv\n" +
+		"foo 9626347B\n" +
+		"sub/bar baz FB1D06C8\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.String())
+	}
+
+	// The generated manifest must verify against the directory it describes
+	checksums, err := parseChecksums(dir, strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv := SFV{Checksums: checksums, Path: filepath.Join(dir, "new.sfv")}
+	ok, err := sfv.Verify(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo", "sub/bar", "RELEASE.SFV"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	err = WalkFiles(dir, func(c Checksum, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, c.Filename)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "foo,sub/bar"; strings.Join(names, ",") != expected {
+		t.Fatalf("Expected %q, got %q", expected, strings.Join(names, ","))
+	}
+
+	// errors are passed to fn, which decides whether to carry on
+	missing := filepath.Join(dir, "missing")
+	var failed []string
+	err = WalkFiles(missing, func(c Checksum, err error) error {
+		failed = append(failed, c.Path)
+		return nil
+	})
+	if err != nil || len(failed) != 1 || failed[0] != missing {
+		t.Fatalf("Expected %s to be reported and skipped, got %v, %v", missing, failed, err)
+	}
+	if err := WalkFiles(missing, func(c Checksum, err error) error { return err }); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not exist error, got %v", err)
+	}
+}
+
+func TestCreateFromList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	foo := filepath.Join(dir, "foo")
+	bar := filepath.Join(dir, "bar baz")
+	if err := ioutil.WriteFile(foo, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bar, []byte("bar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := CreateFromList(strings.NewReader(foo+"\n\n"+bar+"\n"), &b, crc32.Castagnoli); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; Generated by verifysfv\n" +
+		filepath.ToSlash(foo) + " 9626347B\n" +
+		filepath.ToSlash(bar) + " FB1D06C8\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.String())
+	}
+
+	if err := CreateFromList(strings.NewReader("/nonexistent/foo\n"), &b, crc32.Castagnoli); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing file error, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package verifysfv
+
+import "bytes"
+
+// Equal reports whether s and other list the same filenames with the same
+// checksums, regardless of order.
+func (s *SFV) Equal(other *SFV) bool {
+	added, removed, changed := s.Diff(other)
+	return len(added) == 0 && len(removed) == 0 && len(changed) == 0
+}
+
+// Diff compares s, e.g. an old manifest, against other, e.g. one regenerated
+// since, by filename and checksum. added holds the checksums only in other and
+// removed those only in s, while changed holds the checksums from other whose
+// file is listed in both with a different checksum.
+func (s *SFV) Diff(other *SFV) (added, removed, changed []Checksum) {
+	old := make(map[string]Checksum, len(s.Checksums))
+	for _, c := range s.Checksums {
+		old[c.Filename] = c
+	}
+	seen := make(map[string]bool, len(other.Checksums))
+	for _, c := range other.Checksums {
+		seen[c.Filename] = true
+		prev, ok := old[c.Filename]
+		switch {
+		case !ok:
+			added = append(added, c)
+		case prev.Algorithm != c.Algorithm || !bytes.Equal(prev.expectedDigest(), c.expectedDigest()):
+			changed = append(changed, c)
+		}
+	}
+	for _, c := range s.Checksums {
+		if !seen[c.Filename] {
+			removed = append(removed, c)
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,47 @@
+package verifysfv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := ReadFrom(strings.NewReader("same 00000001\nchanged 00000002\nremoved 00000003\n"), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	regenerated, err := ReadFrom(strings.NewReader("added 00000004\nchanged 00000005\nsame 00000001\n"), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, removed, changed := old.Diff(regenerated)
+	names := func(checksums []Checksum) []string {
+		var names []string
+		for _, c := range checksums {
+			names = append(names, c.Filename)
+		}
+		return names
+	}
+	if expected := []string{"added"}; !reflect.DeepEqual(names(added), expected) {
+		t.Fatalf("Expected added %v, got %v", expected, names(added))
+	}
+	if expected := []string{"removed"}; !reflect.DeepEqual(names(removed), expected) {
+		t.Fatalf("Expected removed %v, got %v", expected, names(removed))
+	}
+	if len(changed) != 1 || changed[0].Filename != "changed" || changed[0].CRC32 != 5 {
+		t.Fatalf("Expected changed to hold the new checksum, got %+v", changed)
+	}
+	if old.Equal(regenerated) {
+		t.Fatal("Expected manifests to differ")
+	}
+
+	reordered, err := ReadFrom(strings.NewReader("removed 3\nsame 1\nchanged 2\n"), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !old.Equal(reordered) {
+		t.Fatal("Expected reordered manifests to be equal")
+	}
+}
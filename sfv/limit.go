@@ -0,0 +1,79 @@
+package verifysfv
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket capping the combined rate at which files are
+// read through it, in bytes per second. A single Limiter is shared by all
+// workers of a verification, so the cap applies to the whole run. Up to one
+// second's worth of bytes may be read in a burst after a pause.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64 // bytes that may be read now, negative when in debt
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing bytesPerSecond bytes to be read per
+// second, which must be positive.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	return &Limiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// wait takes n bytes from the bucket, sleeping until they have been earned
+// back if the bucket is overdrawn, or until ctx is cancelled.
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reader returns r throttled by l, or r itself if l is nil.
+func (l *Limiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: l}
+}
+
+// limitedReader is an io.Reader throttled by a Limiter.
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// never read more than a burst at once, or slow limits would be exceeded
+	// by a single large buffer
+	if burst := int(lr.l.rate); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := lr.r.Read(p)
+	if werr := lr.l.wait(lr.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
@@ -0,0 +1,41 @@
+package verifysfv
+
+import (
+	"bytes"
+	"context"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	content := bytes.Repeat([]byte("foo\n"), 3750) // 15000 bytes
+	f, err := tempFile(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	c := Checksum{Filename: "foo", Path: f.Name(), CRC32: crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli))}
+
+	// the first 10000 bytes are a burst, the remaining 5000 take half a second
+	start := time.Now()
+	r := c.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Limiter: NewLimiter(10000)})
+	if !r.OK || r.Err != nil {
+		t.Fatalf("Expected a throttled read to verify, got %v", r.Err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("Expected reading 15000 bytes at 10000 bytes/s to take at least 400ms, took %s", elapsed)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewLimiter(1)
+	cancel()
+	_, err := ioutil.ReadAll(l.reader(ctx, bytes.NewReader([]byte("foo\n"))))
+	if err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,54 @@
+package verifysfv
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"time"
+)
+
+// errMmapUnsupported is returned by mmapSum when a file cannot be mapped and
+// should be streamed instead.
+var errMmapUnsupported = errors.New("mmap unsupported")
+
+// VerifyMmap is like Verify, but maps the file into memory instead of reading
+// it through a buffer, which saves a read syscall per buffer on large files.
+// Files that cannot be mapped, such as empty files, files too large for the
+// address space or any file on platforms without mmap, are streamed instead.
+func (c *Checksum) VerifyMmap(polynomial uint32) (bool, uint32, error) {
+	start := time.Now()
+	h, n, err := c.mmapSum(c.Algorithm, polynomial)
+	if err == errMmapUnsupported {
+		h, n, err = c.sum(context.Background(), c.Algorithm, VerifyOptions{Polynomial: polynomial})
+	}
+	r := c.result(h, n, time.Since(start), err)
+	return r.OK, r.Computed, r.Err
+}
+
+// mmapSum hashes the associated file by mapping it into memory.
+func (c *Checksum) mmapSum(algorithm HashAlgorithm, polynomial uint32) (hash.Hash, int64, error) {
+	f, err := openFile(c.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	// Mapping a zero-length file fails, as does mapping more than fits in int
+	size := fi.Size()
+	if !fi.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		return nil, 0, errMmapUnsupported
+	}
+	data, err := mmap(f, int(size))
+	if err != nil {
+		return nil, 0, errMmapUnsupported
+	}
+	defer munmap(data)
+
+	h := algorithm.New(polynomial)
+	h.Write(data)
+	return h, size, nil
+}
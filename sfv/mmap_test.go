@@ -0,0 +1,87 @@
+package verifysfv
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerifyMmap(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	c := Checksum{Filename: "foo", Path: f.Name(), CRC32: 0x9626347b}
+	ok, result, err := c.VerifyMmap(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("Expected true, got false (computed %x)", result)
+	}
+
+	c.Path = f.Name() + ".missing"
+	if _, _, err := c.VerifyMmap(crc32.Castagnoli); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestVerifyMmapEmptyFile(t *testing.T) {
+	f, err := tempFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	c := Checksum{Filename: "empty", Path: f.Name(), CRC32: 0}
+	ok, _, err := c.VerifyMmap(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+}
+
+func benchmarkFile(b *testing.B, size int) Checksum {
+	f, err := ioutil.TempFile("", "gosfv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(size))
+	return Checksum{Filename: "bench", Path: f.Name()}
+}
+
+func BenchmarkVerifyLargeFile(b *testing.B) {
+	c := benchmarkFile(b, 64<<20)
+	defer os.Remove(c.Path)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Verify(crc32.Castagnoli)
+	}
+}
+
+func BenchmarkVerifyMmapLargeFile(b *testing.B) {
+	c := benchmarkFile(b, 64<<20)
+	defer os.Remove(c.Path)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.VerifyMmap(crc32.Castagnoli)
+	}
+}
+
+func BenchmarkVerifyAdaptiveLargeFile(b *testing.B) {
+	c := benchmarkFile(b, 64<<20)
+	defer os.Remove(c.Path)
+	SetAdaptiveBufSize(1 << 20)
+	defer SetAdaptiveBufSize(0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Verify(crc32.Castagnoli)
+	}
+}
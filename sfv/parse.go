@@ -0,0 +1,41 @@
+package verifysfv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// errNulByte is reported for lines holding a NUL byte, which no filename can
+// contain.
+var errNulByte = errors.New("line contains a NUL byte")
+
+// Diagnostic describes a line of a manifest that Parse skipped.
+type Diagnostic struct {
+	Line    int    // 1-based line number
+	Content string // raw content of the line
+	Err     error  // why the line was skipped
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %v", d.Line, d.Err)
+}
+
+// Parse parses the content of a SFV file, such as one received over the
+// network, for callers that can't trust it to be well-formed. Unlike Read, it
+// doesn't stop at the first malformed line, but skips it and describes it in
+// a Diagnostic. Filenames are left relative, as the SFV has no directory.
+//
+// Parse never panics. The error is only set if data couldn't be split into
+// lines at all, e.g. because a line is longer than 1 MiB.
+func Parse(data []byte) (*SFV, []Diagnostic, error) {
+	sfv, err := readFrom(bytes.NewReader(data), "", CRC32, ReadOptions{Lenient: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	var diagnostics []Diagnostic
+	for _, w := range sfv.Warnings {
+		diagnostics = append(diagnostics, Diagnostic{Line: w.Line, Content: w.Content, Err: w.Err})
+	}
+	return sfv, diagnostics, nil
+}
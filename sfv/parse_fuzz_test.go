@@ -0,0 +1,31 @@
+//go:build go1.18
+// +build go1.18
+
+package verifysfv
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte("; Generated by hand\nfoo 9626347B\nbar baz FB1D06C8 ; comment\n"))
+	f.Add([]byte("\uFEFFfoo\t1\r\n;    4  12:34.56 2020-01-02 foo\r; 1 files, 4 bytes\n"))
+	f.Add([]byte("  \t \x00 ; ;; \t DEADBEEF\n\n\r\r"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sfv, diagnostics, err := Parse(data)
+		if err != nil {
+			return
+		}
+		for _, c := range sfv.Checksums {
+			if c.Filename == "" || strings.IndexByte(c.Filename, 0) >= 0 {
+				t.Fatalf("Expected a valid filename, got %q", c.Filename)
+			}
+		}
+		for _, d := range diagnostics {
+			if d.Line < 1 || d.Err == nil {
+				t.Fatalf("Expected a line number and an error, got %+v", d)
+			}
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package verifysfv
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	in := "; Generated by hand\n" +
+		"foo 9626347B\n" +
+		"   \t   \n" +
+		"nocrc\n" +
+		"bad\x00name FB1D06C8\n" +
+		"bar XYZ\n" +
+		"sub/bar baz FB1D06C8\n"
+	sfv, diagnostics, err := Parse([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 2 || sfv.Checksums[0].Path != "foo" || sfv.Checksums[1].Filename != "sub/bar baz" {
+		t.Fatalf("Expected foo and sub/bar baz, got %+v", sfv.Checksums)
+	}
+	lines := []int{4, 5, 6}
+	if len(diagnostics) != len(lines) {
+		t.Fatalf("Expected %d diagnostics, got %v", len(lines), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.Line != lines[i] {
+			t.Fatalf("Expected line %d, got %d", lines[i], d.Line)
+		}
+	}
+	if !errors.Is(diagnostics[1].Err, errNulByte) {
+		t.Fatalf("Expected %v, got %v", errNulByte, diagnostics[1].Err)
+	}
+	if expected := `line 4: missing CRC32 for file "nocrc"`; diagnostics[0].String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, diagnostics[0].String())
+	}
+
+	if _, _, err := Parse([]byte(strings.Repeat("a", maxLineLength+1))); err == nil {
+		t.Fatal("Expected an error for a line that is too long")
+	}
+}
@@ -0,0 +1,161 @@
+package verifysfv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VerifyReport aggregates the results of verifying a SFV and renders them as
+// text or json, so that callers don't each reinvent report formatting.
+type VerifyReport struct {
+	// Results holds every result in the order verification finished. It is
+	// left out of the json if nil or empty, e.g. for a report of the totals
+	// only.
+	Results []VerifyResult
+	Summary Summary
+	Skipped int           // checksums not verified, e.g. because of SkipMissing
+	Cached  int           // results that are OK because VerifyOptions.Cache held them
+	Elapsed time.Duration // time spent verifying all files
+}
+
+// Add records r in the report.
+func (r *VerifyReport) Add(result VerifyResult) {
+	r.Results = append(r.Results, result)
+	r.Summary.Add(result)
+	if result.Cached {
+		r.Cached++
+	}
+}
+
+// Problem describes what went wrong with r, such as "corruption: expected
+// 9626347B but computed FB1D06C8 for foo", or returns "" if r is OK.
+func (r VerifyResult) Problem() string {
+	if r.Err != nil {
+		return r.Err.Error()
+	}
+	if !r.OK {
+		return fmt.Sprintf("corruption: expected %s but computed %s for %s",
+			r.ExpectedHex(), r.ComputedHex(), r.Filename)
+	}
+	return ""
+}
+
+// Tally returns the counts of the report, such as "3 ok, 1 missing, 2
+// corrupt, 4 skipped, 1 cached".
+func (r *VerifyReport) Tally() string {
+	tally := r.Summary.String()
+	if r.Skipped > 0 {
+		tally += fmt.Sprintf(", %d skipped", r.Skipped)
+	}
+	if r.Cached > 0 {
+		tally += fmt.Sprintf(", %d cached", r.Cached)
+	}
+	return tally
+}
+
+// Throughput returns a line such as "read 1024 bytes in 2ms (0.5 MB/s)".
+func (r *VerifyReport) Throughput() string {
+	n := r.Summary.Bytes()
+	return fmt.Sprintf("read %d bytes in %s (%.1f MB/s)",
+		n, r.Elapsed.Round(time.Millisecond), megabytesPerSecond(n, r.Elapsed))
+}
+
+// Text returns the report as printed by the CLI: a line for every file that
+// failed to verify, followed by the Tally and Throughput.
+func (r *VerifyReport) Text() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		if problem := result.Problem(); problem != "" {
+			b.WriteString(problem + "\n")
+		}
+	}
+	b.WriteString(r.Tally() + "\n")
+	b.WriteString(r.Throughput() + "\n")
+	return b.String()
+}
+
+// jsonResult is the json representation of a VerifyResult.
+type jsonResult struct {
+	Filename string  `json:"filename"`
+	Expected string  `json:"expected"`
+	Computed string  `json:"computed,omitempty"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Bytes    int64   `json:"bytes"`
+	Seconds  float64 `json:"seconds"`
+	MBPerSec float64 `json:"mb_per_sec"`
+	Size     *int64  `json:"size,omitempty"` // nil if the file couldn't be stat'd
+	ModTime  string  `json:"mtime,omitempty"`
+	Cached   bool    `json:"cached,omitempty"`
+	Reads    int64   `json:"reads,omitempty"`
+}
+
+// jsonSummary is the json representation of the totals of a VerifyReport.
+type jsonSummary struct {
+	OK       int     `json:"ok"`
+	Missing  int     `json:"missing"`
+	Corrupt  int     `json:"corrupt"`
+	Failed   int     `json:"failed"`
+	Skipped  int     `json:"skipped"`
+	Cached   int     `json:"cached,omitempty"`
+	Bytes    int64   `json:"bytes"`
+	Seconds  float64 `json:"seconds"`
+	MBPerSec float64 `json:"mb_per_sec"`
+}
+
+// MarshalJSON encodes r with hex digests, its status and throughput, and the
+// size and modification time of the file if they are known.
+func (r VerifyResult) MarshalJSON() ([]byte, error) {
+	jr := jsonResult{
+		Filename: r.Filename,
+		Expected: r.ExpectedHex(),
+		Computed: r.ComputedHex(),
+		Status:   r.Status(),
+		Bytes:    r.Bytes,
+		Seconds:  r.Elapsed.Seconds(),
+		MBPerSec: megabytesPerSecond(r.Bytes, r.Elapsed),
+		Cached:   r.Cached,
+		Reads:    r.Reads,
+	}
+	if r.Err != nil {
+		jr.Error = r.Err.Error()
+	}
+	if !r.ModTime.IsZero() {
+		jr.Size = &r.Size
+		jr.ModTime = r.ModTime.UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(jr)
+}
+
+// MarshalJSON encodes r as an object holding its results and a summary of
+// the totals.
+func (r *VerifyReport) MarshalJSON() ([]byte, error) {
+	n := r.Summary.Bytes()
+	return json.Marshal(struct {
+		Results []VerifyResult `json:"results,omitempty"`
+		Summary jsonSummary    `json:"summary"`
+	}{
+		Results: r.Results,
+		Summary: jsonSummary{
+			OK:       len(r.Summary.OK),
+			Missing:  len(r.Summary.Missing),
+			Corrupt:  len(r.Summary.Corrupt),
+			Failed:   len(r.Summary.Failed),
+			Skipped:  r.Skipped,
+			Cached:   r.Cached,
+			Bytes:    n,
+			Seconds:  r.Elapsed.Seconds(),
+			MBPerSec: megabytesPerSecond(n, r.Elapsed),
+		},
+	})
+}
+
+// megabytesPerSecond returns the throughput of reading n bytes in d.
+func megabytesPerSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / 1e6 / d.Seconds()
+}
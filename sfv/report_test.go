@@ -0,0 +1,95 @@
+package verifysfv
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyWithReport(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	report := &VerifyReport{}
+	if _, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Report: report}); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 2 || len(report.Summary.OK) != 2 {
+		t.Fatalf("Expected 2 ok results, got %s", report.Summary)
+	}
+	for _, r := range report.Results {
+		if r.Size != 4 || r.ModTime.IsZero() {
+			t.Fatalf("Expected a size of 4 and a modification time, got %d, %v", r.Size, r.ModTime)
+		}
+	}
+	if !strings.HasPrefix(report.Text(), "2 ok, 0 missing, 0 corrupt\nread 8 bytes in ") {
+		t.Fatalf("Expected a tally and throughput, got %q", report.Text())
+	}
+}
+
+func TestVerifyReportText(t *testing.T) {
+	report := &VerifyReport{Skipped: 1, Elapsed: time.Second}
+	report.Add(VerifyResult{Filename: "foo", OK: true, Bytes: 4})
+	report.Add(VerifyResult{Filename: "bar", ExpectedDigest: []byte{0xff}, ComputedDigest: []byte{0xfe}, Bytes: 4})
+	report.Add(VerifyResult{Filename: "baz", Err: errors.New("open baz: no such file or directory")})
+	expected := "corruption: expected FF but computed FE for bar\n" +
+		"open baz: no such file or directory\n" +
+		"1 ok, 0 missing, 1 corrupt, 1 failed, 1 skipped\n" +
+		"read 8 bytes in 1s (0.0 MB/s)\n"
+	if report.Text() != expected {
+		t.Fatalf("Expected %q, got %q", expected, report.Text())
+	}
+
+	report.Add(VerifyResult{Filename: "qux", OK: true, Cached: true})
+	if expected := "2 ok, 0 missing, 1 corrupt, 1 failed, 1 skipped, 1 cached"; report.Tally() != expected {
+		t.Fatalf("Expected %q, got %q", expected, report.Tally())
+	}
+}
+
+func TestVerifyReportJSON(t *testing.T) {
+	report := &VerifyReport{Elapsed: time.Second}
+	report.Add(VerifyResult{Filename: "bar", ExpectedDigest: []byte{0xff}, ComputedDigest: []byte{0xfe}, Bytes: 2e6})
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"results":[{"filename":"bar","expected":"FF","computed":"FE","status":"corrupt","bytes":2000000,"seconds":0,"mb_per_sec":0}],` +
+		`"summary":{"ok":0,"missing":0,"corrupt":1,"failed":0,"skipped":0,"bytes":2000000,"seconds":1,"mb_per_sec":2}}`
+	if string(b) != expected {
+		t.Fatalf("Expected %s, got %s", expected, b)
+	}
+
+	// files that could be stat'd have their size and modification time
+	r := VerifyResult{Filename: "foo", OK: true, Size: 0, ModTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	b, err = json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), `"size":0,"mtime":"2020-01-02T03:04:05Z"}`) {
+		t.Fatalf("Expected a size and mtime, got %s", b)
+	}
+
+	// a report without results holds just the totals
+	b, err = json.Marshal(&VerifyReport{Summary: report.Summary, Elapsed: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "results") {
+		t.Fatalf("Expected no results, got %s", b)
+	}
+}
@@ -0,0 +1,87 @@
+package verifysfv
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Sanitize chooses what ReadOptions does with filenames holding characters
+// that Windows filesystems don't allow, such as "?" or ":", which on NTFS
+// names an alternate data stream of another file rather than a file.
+type Sanitize int
+
+const (
+	// SanitizeOff keeps filenames as listed. This is the default.
+	SanitizeOff Sanitize = iota
+	// SanitizeReplace replaces each invalid character with "_", as most
+	// tools do when writing such files to a Windows filesystem. The name
+	// as listed is kept in Checksum.Original.
+	SanitizeReplace
+	// SanitizeReject fails to read manifests listing such filenames with an
+	// InvalidFilenameError, or skips them with ReadOptions.Lenient.
+	SanitizeReject
+)
+
+// invalidFilenameChars are the printable characters Windows doesn't allow
+// in filenames. Control characters aren't allowed either. Backslashes are
+// path separators, see ReadOptions.KeepBackslashes.
+const invalidFilenameChars = `<>:"|?*`
+
+// sanitizeFilename returns filename with every character Windows doesn't
+// allow replaced with "_".
+func sanitizeFilename(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(invalidFilenameChars, r) {
+			return '_'
+		}
+		return r
+	}, filename)
+}
+
+// InvalidFilenameError is returned with SanitizeReject for a filename
+// holding characters Windows doesn't allow.
+type InvalidFilenameError struct {
+	Filename  string
+	Sanitized string // Filename as SanitizeReplace would have read it
+}
+
+func (e *InvalidFilenameError) Error() string {
+	return fmt.Sprintf("filename %q holds characters invalid on Windows, sanitized it would be %q", e.Filename, e.Sanitized)
+}
+
+// SanitizedError wraps an error verifying a file whose name was changed by
+// SanitizeReplace, naming both the original and the sanitized filename.
+type SanitizedError struct {
+	Original  string
+	Sanitized string
+	Err       error
+}
+
+func (e *SanitizedError) Error() string {
+	return fmt.Sprintf("%v (sanitized from %q to %q)", e.Err, e.Original, e.Sanitized)
+}
+
+// Unwrap returns the underlying error.
+func (e *SanitizedError) Unwrap() error { return e.Err }
+
+// sanitizing returns parse, sanitizing the filenames of the checksums it
+// parses according to mode.
+func sanitizing(parse func(dir, line string) (*Checksum, error), mode Sanitize) func(dir, line string) (*Checksum, error) {
+	return func(dir, line string) (*Checksum, error) {
+		c, err := parse(dir, line)
+		if err != nil {
+			return nil, err
+		}
+		sanitized := sanitizeFilename(c.Filename)
+		if sanitized == c.Filename {
+			return c, nil
+		}
+		if mode == SanitizeReject {
+			return nil, &InvalidFilenameError{Filename: c.Filename, Sanitized: sanitized}
+		}
+		c.Original, c.Filename = c.Filename, sanitized
+		c.Path = path.Join(dir, sanitized)
+		return c, nil
+	}
+}
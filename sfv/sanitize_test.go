@@ -0,0 +1,89 @@
+package verifysfv
+
+import (
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"plain.txt":        "plain.txt",
+		"a:b?.txt":         "a_b_.txt",
+		`dir/"quoted"|*.x`: "dir/_quoted___.x",
+		"tab\there":        "tab_here",
+		"ünïcode<>.bin":    "ünïcode__.bin",
+	}
+	for in, expected := range cases {
+		if sanitized := sanitizeFilename(in); sanitized != expected {
+			t.Fatalf("Expected %q, got %q", expected, sanitized)
+		}
+	}
+}
+
+func TestReadSanitize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // Ignore error
+	if err := ioutil.WriteFile(filepath.Join(dir, "a_b_.txt"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "test.sfv")
+	content := "a:b?.txt 9626347B\nmissing:file FB1D06C8\nplain FB1D06C8\n"
+	if err := ioutil.WriteFile(manifest, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// by default names are kept, so the file isn't found
+	sfv, err := Read(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sfv.Checksums[0].Filename != "a:b?.txt" || sfv.Checksums[0].Original != "" {
+		t.Fatalf("Expected %q, got %q", "a:b?.txt", sfv.Checksums[0].Filename)
+	}
+
+	// replaced names are verified, and errors name both
+	sfv, err = ReadWithOptions(manifest, ReadOptions{Sanitize: SanitizeReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := sfv.Checksums[0]
+	if c.Filename != "a_b_.txt" || c.Original != "a:b?.txt" || c.Path != filepath.Join(dir, "a_b_.txt") {
+		t.Fatalf("Expected a_b_.txt sanitized from a:b?.txt, got %+v", c)
+	}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.OK) != 1 || len(summary.Missing) != 2 {
+		t.Fatalf("Expected 1 ok and 2 missing, got %s", summary)
+	}
+	var sanitized *SanitizedError
+	if !errors.As(summary.Missing[0].Err, &sanitized) {
+		t.Fatalf("Expected a SanitizedError, got %v", summary.Missing[0].Err)
+	}
+	if !strings.HasSuffix(sanitized.Error(), `(sanitized from "missing:file" to "missing_file")`) {
+		t.Fatalf("Expected the original and sanitized names, got %q", sanitized.Error())
+	}
+
+	// rejected names fail the read, or are skipped when lenient
+	_, err = ReadWithOptions(manifest, ReadOptions{Sanitize: SanitizeReject})
+	var invalid *InvalidFilenameError
+	if !errors.As(err, &invalid) || invalid.Filename != "a:b?.txt" || invalid.Sanitized != "a_b_.txt" {
+		t.Fatalf("Expected an InvalidFilenameError for a:b?.txt, got %v", err)
+	}
+	sfv, err = ReadWithOptions(manifest, ReadOptions{Sanitize: SanitizeReject, Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 1 || len(sfv.Warnings) != 2 {
+		t.Fatalf("Expected 1 checksum and 2 warnings, got %d and %d", len(sfv.Checksums), len(sfv.Warnings))
+	}
+}
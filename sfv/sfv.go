@@ -4,92 +4,1469 @@ package verifysfv
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"hash/crc32"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// HashAlgorithm identifies the algorithm used to compute a checksum.
+type HashAlgorithm int
+
+const (
+	// CRC32 is used by SFV files. The polynomial is chosen at verification.
+	CRC32 HashAlgorithm = iota
+	// MD5 is used by md5sum-style .md5 files.
+	MD5
+	// SHA1 is used by sha1sum-style .sha1 files.
+	SHA1
+	// SHA256 is used by sha256sum-style .sha256 files.
+	SHA256
+)
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case CRC32:
+		return "crc32"
+	case MD5:
+		return "md5"
+	case SHA1:
+		return "sha1"
+	case SHA256:
+		return "sha256"
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(a))
+}
+
+// New returns a new hash computing the algorithm. polynomial is only used for
+// CRC32.
+func (a HashAlgorithm) New(polynomial uint32) hash.Hash {
+	switch a {
+	case MD5:
+		return md5.New()
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	default:
+		return crc32.New(crcTable(polynomial))
+	}
+}
+
+// crcTables caches a *crc32.Table per polynomial so that verifying many small
+// files doesn't rebuild the same table for every file.
+var crcTables sync.Map
+
+// crcTable returns the cached table for polynomial, building it on first use.
+func crcTable(polynomial uint32) *crc32.Table {
+	polynomial = resolvePolynomial(polynomial)
+	if t, ok := crcTables.Load(polynomial); ok {
+		return t.(*crc32.Table)
+	}
+	t, _ := crcTables.LoadOrStore(polynomial, crc32.MakeTable(polynomial))
+	return t.(*crc32.Table)
+}
+
+// resolvePolynomial returns polynomial, or IEEE if it is Auto. It is the one
+// place where Auto falls back to IEEE.
+func resolvePolynomial(polynomial uint32) uint32 {
+	if polynomial == uint32(Auto) {
+		return crc32.IEEE
+	}
+	return polynomial
+}
+
+// Size returns the length of the algorithm's digest in bytes.
+func (a HashAlgorithm) Size() int {
+	switch a {
+	case MD5:
+		return md5.Size
+	case SHA1:
+		return sha1.Size
+	case SHA256:
+		return sha256.Size
+	default:
+		return crc32.Size
+	}
+}
+
+// Polynomial is a CRC32 polynomial in reversed notation, as used by
+// hash/crc32.
+type Polynomial uint32
+
+const (
+	// Castagnoli is the CRC-32C polynomial, the default of the CLI.
+	Castagnoli Polynomial = crc32.Castagnoli
+	// IEEE is the polynomial used by most SFV tools.
+	IEEE Polynomial = crc32.IEEE
+	// Koopman is Koopman's polynomial.
+	Koopman Polynomial = crc32.Koopman
+	// Auto verifies with the Polynomial recorded on the SFV being verified,
+	// or with IEEE if there is none. Methods that don't know the SFV, such as
+	// those of Checksum, use IEEE.
+	Auto Polynomial = 0
+)
+
+// ParsePolynomial parses a polynomial name, "crc32c", "ieee" or "koopman"
+// ("koop" for short), "auto", or a custom polynomial given in hex such as
+// "0x82F63B78".
+func ParsePolynomial(s string) (uint32, error) {
+	switch strings.ToLower(s) {
+	case "auto":
+		return uint32(Auto), nil
+	case "crc32c", "castagnoli":
+		return uint32(Castagnoli), nil
+	case "ieee":
+		return uint32(IEEE), nil
+	case "koop", "koopman":
+		return uint32(Koopman), nil
+	}
+	hexPoly := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if !isHex(hexPoly) {
+		return 0, fmt.Errorf("unsupported polynomial %s", s)
+	}
+	p, err := strconv.ParseUint(hexPoly, 16, 32)
+	if err != nil || p == 0 {
+		return 0, fmt.Errorf("unsupported polynomial %s", s)
+	}
+	return uint32(p), nil
+}
+
+// ParseCRC32 parses a CRC32 given as 1 to 8 hex digits like in SFV files,
+// optionally prefixed with "0x" or "0X", such as "0xDEADBEEF".
+func ParseCRC32(s string) (uint32, error) {
+	field := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(field) > 8 || !isHex(field) {
+		return 0, fmt.Errorf("invalid CRC32 %q", s)
+	}
+	crc, err := strconv.ParseUint(field, 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(crc), nil
+}
+
+// algorithmForExt returns the algorithm used by checksum files with the given
+// extension, defaulting to CRC32 for SFV files.
+func algorithmForExt(ext string) HashAlgorithm {
+	switch strings.ToLower(ext) {
+	case ".md5":
+		return MD5
+	case ".sha1":
+		return SHA1
+	case ".sha256":
+		return SHA256
+	}
+	return CRC32
+}
+
 // Checksum represents a line in a SFV file, containing the filename, full path
-// to the file and the CRC32 checksum
+// to the file and the CRC32 checksum. Checksums computed with other algorithms
+// store their expected digest in Digest instead of CRC32.
 type Checksum struct {
+	Filename  string
+	Path      string
+	CRC32     uint32
+	Algorithm HashAlgorithm
+	Digest    []byte
+	Size      int64 // expected size in bytes, or 0 if unknown
+	// Original is the filename as listed in the SFV if ReadOptions.Sanitize
+	// changed it, or "" otherwise.
+	Original string
+}
+
+// String returns c as a line of the checksum file it was read from:
+// "filename CRC32" with 8 uppercase hex digits for SFV files, or md5sum-style
+// "digest  filename" for other algorithms.
+func (c Checksum) String() string {
+	if c.Algorithm == CRC32 {
+		return fmt.Sprintf("%s %08X", c.Filename, c.CRC32)
+	}
+	return fmt.Sprintf("%x  %s", c.Digest, c.Filename)
+}
+
+// TruncatedError is returned when a file is smaller than the size recorded for
+// it in the manifest, which usually means an incomplete copy or download
+// rather than corruption of the content.
+type TruncatedError struct {
 	Filename string
-	Path     string
-	CRC32    uint32
+	Size     int64 // bytes actually read
+	Expected int64
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("truncated: got %d of %d bytes for %s", e.Size, e.Expected, e.Filename)
+}
+
+// ParseError is returned when a line in a checksum file cannot be parsed.
+type ParseError struct {
+	Line    int    // 1-based line number
+	Content string // raw content of the line
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: could not parse checksum %q: %v", e.Line, e.Content, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+var errMissingField = errors.New("expected a filename and a checksum")
+
+// DuplicateError is returned by SFV.Deduplicate when filenames are listed
+// more than once with different checksums.
+type DuplicateError struct {
+	Filenames []string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("conflicting checksums for %s", strings.Join(e.Filenames, ", "))
+}
+
+// SFV contains all the checksums read from a SFV file.
+//
+// The Verify methods only read SFV, so any number of them may run
+// concurrently on the same SFV. Progress callbacks passed to them are called
+// from the calling goroutine, in order, and are never shared between calls.
+// Methods that modify SFV, such as Sort and Deduplicate, must not run
+// concurrently with anything else.
+type SFV struct {
+	Checksums []Checksum
+	Path      string
+	Warnings  []*ParseError // lines skipped by ReadOptions.Lenient
+	// ExpectedFileCount and ExpectedByteCount are the totals recorded in a
+	// trailer comment such as "; 3 files, 12345 bytes", or 0 if there was
+	// none. See ValidateTrailer.
+	ExpectedFileCount int64
+	ExpectedByteCount int64
+	// Algorithm is the hash algorithm of the checksums, chosen by Read from
+	// the file extension.
+	Algorithm HashAlgorithm
+	// Polynomial is the CRC32 polynomial the checksums were computed with,
+	// used when verifying with Auto. SFV files don't record it, so Read
+	// leaves it Auto, which verifies with IEEE, the polynomial used by most
+	// SFV tools.
+	Polynomial uint32
+	// Header holds the comment lines, such as "; Generated by cksfv", found
+	// before the first checksum, other than file size and trailer comments.
+	// WriteTo writes them in place of its own header to preserve provenance.
+	Header []string
+}
+
+// polynomial returns p, or the Polynomial of SFV if p is Auto, resolving
+// Auto to IEEE if neither is set.
+func (s *SFV) polynomial(p uint32) uint32 {
+	if p == uint32(Auto) {
+		p = s.Polynomial
+	}
+	return resolvePolynomial(p)
+}
+
+var bufSize uint64 = 4096
+
+// MinBufSize is the smallest read buffer size accepted by SetBufSize.
+const MinBufSize = 512
+
+// SetBufSize sets the size in bytes of the buffer used to read files during
+// verification. Sizes below MinBufSize are raised to MinBufSize, while zero or
+// negative sizes are rejected and leave the current size unchanged.
+func SetBufSize(bs int) error {
+	if bs <= 0 {
+		return fmt.Errorf("invalid buffer size %d", bs)
+	}
+	if bs < MinBufSize {
+		bs = MinBufSize
+	}
+	atomic.SwapUint64(&bufSize, uint64(bs))
+	return nil
+}
+
+// GetBufSize returns the size in bytes of the buffer used to read files.
+func GetBufSize() uint64 {
+	return atomic.LoadUint64(&bufSize)
+}
+
+// adaptiveBufSize is the cap set by SetAdaptiveBufSize, 0 when disabled.
+var adaptiveBufSize uint64
+
+// SetAdaptiveBufSize sizes the buffer used to read each file to the file's
+// size, capped at max bytes, instead of using the fixed size set by
+// SetBufSize. Small files then don't allocate oversized buffers while large
+// files get larger reads. Caps below MinBufSize are raised to MinBufSize, and
+// a max of 0 disables adaptive sizing again.
+func SetAdaptiveBufSize(max int) error {
+	if max < 0 {
+		return fmt.Errorf("invalid buffer size %d", max)
+	}
+	if max > 0 && max < MinBufSize {
+		max = MinBufSize
+	}
+	atomic.StoreUint64(&adaptiveBufSize, uint64(max))
+	return nil
+}
+
+// fileBufSize returns the read buffer size for a file of the given size when
+// adaptive sizing is enabled, or 0 to use the shared fixed-size buffers.
+func fileBufSize(size int64) int {
+	max := atomic.LoadUint64(&adaptiveBufSize)
+	if max == 0 {
+		return 0
+	}
+	if size < MinBufSize {
+		return MinBufSize
+	}
+	if uint64(size) > max {
+		return int(max)
+	}
+	return int(size)
+}
+
+// bufPool holds read buffers shared across Verify calls. Buffers whose size
+// no longer matches the current buffer size are dropped rather than reused.
+var bufPool sync.Pool
+
+func getBuf() *[]byte {
+	size := GetBufSize()
+	if b, ok := bufPool.Get().(*[]byte); ok && uint64(len(*b)) == size {
+		return b
+	}
+	b := make([]byte, size)
+	return &b
+}
+
+func putBuf(b *[]byte) {
+	if uint64(len(*b)) == GetBufSize() {
+		bufPool.Put(b)
+	}
+}
+
+// VerifyResult is the outcome of verifying a single checksum. Expected and
+// Computed are only set for CRC32 checksums, while ExpectedDigest and
+// ComputedDigest are set for all hash types.
+type VerifyResult struct {
+	Filename       string
+	Expected       uint32
+	Computed       uint32
+	ExpectedDigest []byte
+	ComputedDigest []byte
+	OK             bool
+	Err            error
+	Bytes          int64         // number of bytes read
+	Elapsed        time.Duration // time spent reading and hashing the file
+	MovedTo        string        // path the file was found at by VerifyOptions.SearchMoved
+	Size           int64         // size of the file when verified, or 0 if it couldn't be stat'd
+	ModTime        time.Time     // modification time of the file when verified, if it could be stat'd
+	Cached         bool          // whether the file wasn't read because VerifyOptions.Cache holds it
+	Reads          int64         // number of Read calls made on the file, only counted with VerifyOptions.Stats
+}
+
+// Verify calculates the CRC32 of the associated file and returns true if the
+// checksum is correct along with the calculated checksum
+func (c *Checksum) Verify(polynomial uint32) (bool, uint32, error) {
+	return c.VerifyContext(context.Background(), polynomial)
+}
+
+// VerifyContext is like Verify, but stops reading the file and returns
+// ctx.Err() as soon as ctx is cancelled.
+func (c *Checksum) VerifyContext(ctx context.Context, polynomial uint32) (bool, uint32, error) {
+	r := c.verify(ctx, polynomial)
+	return r.OK, r.Computed, r.Err
+}
+
+// VerifyResult calculates the CRC32 of the associated file and returns the
+// outcome as a VerifyResult.
+func (c *Checksum) VerifyResult(polynomial uint32) VerifyResult {
+	return c.verify(context.Background(), polynomial)
+}
+
+// VerifyResultContext is like VerifyResult, but stops reading the file as
+// soon as ctx is cancelled.
+func (c *Checksum) VerifyResultContext(ctx context.Context, polynomial uint32) VerifyResult {
+	return c.verify(ctx, polynomial)
+}
+
+// ExpectedHex returns the expected checksum in canonical form, as printed in
+// all output: 8 uppercase hex digits for CRC32, including leading zeros, or
+// the digest in uppercase hex for other algorithms.
+func (c *Checksum) ExpectedHex() string {
+	return formatHex(c.expectedDigest())
+}
+
+// ExpectedHex is like Checksum.ExpectedHex for the expected checksum of r.
+func (r VerifyResult) ExpectedHex() string {
+	return formatHex(r.ExpectedDigest)
+}
+
+// ComputedHex returns the checksum computed for r in the same form as
+// ExpectedHex, or "" if the file couldn't be read.
+func (r VerifyResult) ComputedHex() string {
+	return formatHex(r.ComputedDigest)
+}
+
+// formatHex formats a digest as uppercase hex.
+func formatHex(digest []byte) string {
+	return strings.ToUpper(hex.EncodeToString(digest))
+}
+
+// expectedDigest returns the expected digest in the same byte order produced
+// by the hash's Sum method.
+func (c *Checksum) expectedDigest() []byte {
+	if c.Algorithm == CRC32 {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, c.CRC32)
+		return b
+	}
+	return c.Digest
+}
+
+// ErrSymlink is returned, wrapped in a *fs.PathError, when a checksum's file
+// or a directory its filename descends through is a symlink and
+// VerifyOptions.FollowSymlinks is false.
+var ErrSymlink = errors.New("refusing to follow symlink")
+
+// ErrIsDir is returned, wrapped in a *fs.PathError, when a checksum's file is
+// a directory.
+var ErrIsDir = errors.New("expected file but found directory")
+
+// ErrFileTimeout is returned, wrapped in a *fs.PathError, when verifying a
+// file takes longer than VerifyOptions.FileTimeout.
+var ErrFileTimeout = errors.New("timed out verifying file")
+
+// ErrEmptySFV is returned, wrapped with the path of the SFV, when verifying
+// a SFV without any checksums, e.g. one holding nothing but comments, so that
+// an empty manifest can be told apart from corrupt files with errors.Is.
+var ErrEmptySFV = errors.New("no checksums found")
+
+// errEmpty returns ErrEmptySFV wrapped with the path of s.
+func (s *SFV) errEmpty() error {
+	return fmt.Errorf("%w in %s", ErrEmptySFV, s.Path)
+}
+
+// VerifyOptions configures verification. Fields that don't apply to a single
+// checksum are ignored by Checksum.VerifyWithOptions.
+type VerifyOptions struct {
+	// Polynomial is the CRC32 polynomial to verify with. The zero value,
+	// Auto, uses the SFV's Polynomial, which is IEEE unless set otherwise;
+	// note that the CLI's -poly defaults to crc32c instead.
+	Polynomial uint32
+	// Context cancels verification. nil means context.Background().
+	Context context.Context
+	// BaseDir resolves filenames relative to BaseDir instead of the
+	// directory the SFV was read from, like VerifyIn. It takes precedence
+	// over ResolveFrom.
+	BaseDir string
+	// ResolveFrom chooses what filenames are relative to. The default,
+	// SFVDir, keeps the paths the SFV was read with.
+	ResolveFrom ResolveFrom
+	// Workers is the number of files verified concurrently, at least 1.
+	Workers int
+	// FollowSymlinks verifies the targets of symlinked entries. When false,
+	// symlinks, including symlinked directories in a filename, are refused
+	// with ErrSymlink rather than opened, so that only the actual files of
+	// e.g. an untrusted archive are verified.
+	FollowSymlinks bool
+	// SkipMissing leaves files that don't exist out of the results, like
+	// VerifyExisting.
+	SkipMissing bool
+	// Retries is the number of times a file is re-read after a transient
+	// I/O error such as EIO or EAGAIN, e.g. on a flaky network mount.
+	Retries int
+	// RetryDelay is the wait before the first retry, doubling after each
+	// further attempt.
+	RetryDelay time.Duration
+	// FileTimeout, if positive, gives up on a file that takes longer than
+	// this to verify, including retries, and reports it as failed with
+	// ErrFileTimeout, e.g. because a read hangs on a failing drive. The
+	// other files are verified as usual. The hung read is abandoned rather
+	// than interrupted, so it keeps its file and buffer until it returns.
+	FileTimeout time.Duration
+	// Stats, if set, counts the Read calls made on each file in
+	// VerifyResult.Reads and adds them up along with the bytes read. Reads
+	// aren't counted when it is nil.
+	Stats *ReadStats
+	// LargestFirst verifies the largest files first when verifying
+	// concurrently, so that small files fill the gaps at the end rather than
+	// a large file being read alone. Every file is stat'ed upfront.
+	LargestFirst bool
+	// SearchMoved looks for missing files elsewhere under the directory the
+	// filenames are relative to, verifying files with the same base name
+	// until one matches. This is expensive as it walks the whole tree for
+	// every missing file.
+	SearchMoved bool
+	// Open opens the file at a checksum's Path for reading, so that files
+	// can be verified from HTTP, object storage or memory rather than local
+	// disk. nil means os.Open. Open should return an error for which
+	// os.IsNotExist is true for files that don't exist, so that they're
+	// reported as missing. FollowSymlinks, SkipMissing, LargestFirst and
+	// SearchMoved inspect the local filesystem and are ignored when Open is
+	// set.
+	Open Opener
+	// Limiter caps the rate files are read at, e.g. to run background scans
+	// without starving other processes of disk bandwidth. nil means no limit.
+	Limiter *Limiter
+	// Cache, if set, skips reading files it holds that haven't changed since
+	// they last verified OK, and records the files that verify OK. It is
+	// ignored when Open is set.
+	Cache *Cache
+	// MemoryBudget, if positive, keeps the memory spent on read buffers
+	// within this many bytes no matter how large the files are, by sizing
+	// the worker pool and the buffers together:
+	//
+	//	workers = min(max(Workers, 1), MemoryBudget / MinBufSize)
+	//	bufSize = MemoryBudget / workers
+	//
+	// Each worker allocates a single buffer of bufSize bytes up front and
+	// reuses it for every file, bypassing SetBufSize, SetAdaptiveBufSize and
+	// the shared buffer pool, so at most workers * bufSize <= MemoryBudget
+	// bytes of buffers are ever allocated, unless reads are abandoned
+	// because of FileTimeout, in which case the worker allocates a new
+	// buffer. The number of workers is lowered rather than the buffers
+	// shrunk below MinBufSize, and verification fails if MemoryBudget is
+	// smaller than MinBufSize.
+	MemoryBudget int
+	// Report, if set, records every result, the checksums left out by
+	// SkipMissing and the time spent verifying. Results are added to those
+	// already in it.
+	Report *VerifyReport
+	// OnResult, if set, is called with each result as soon as its file has
+	// been verified. Even with Workers > 1, it is only called from the
+	// goroutine verifying the SFV, so it needs no locking of its own.
+	OnResult func(VerifyResult)
+	// Progress, if set, is incremented after each file has been verified,
+	// from the same goroutine as OnResult.
+	Progress Progress
+
+	// bufSize, set from MemoryBudget, gives each worker of stream a read
+	// buffer of its own of this size, which is reused for every file.
+	bufSize int
+	// buf is the read buffer of the worker verifying a checksum, used
+	// instead of the shared pool.
+	buf []byte
+	// reads counts the Read calls made on the file being verified, when
+	// Stats is set.
+	reads *int64
+}
+
+// Opener opens the file at path for reading.
+type Opener func(path string) (io.ReadCloser, error)
+
+// ResolveFrom selects the directory filenames in a SFV are resolved against.
+type ResolveFrom int
+
+const (
+	// SFVDir resolves filenames relative to the directory of the SFV file.
+	SFVDir ResolveFrom = iota
+	// CWD resolves filenames relative to the current working directory, for
+	// running from the data directory with a manifest kept elsewhere.
+	CWD
+)
+
+// context returns opts.Context, defaulting to context.Background().
+func (opts VerifyOptions) context() context.Context {
+	if opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// VerifyWithOptions calculates the checksum of the associated file according
+// to opts and returns the outcome as a VerifyResult.
+func (c *Checksum) VerifyWithOptions(opts VerifyOptions) VerifyResult {
+	return c.verifyWithOptions(opts.context(), opts)
+}
+
+func (c *Checksum) verify(ctx context.Context, polynomial uint32) VerifyResult {
+	return c.verifyWithOptions(ctx, VerifyOptions{Polynomial: polynomial, FollowSymlinks: true})
+}
+
+func (c *Checksum) verifyWithOptions(ctx context.Context, opts VerifyOptions) VerifyResult {
+	if !opts.FollowSymlinks && opts.Open == nil {
+		if link, ok := c.symlink(); ok {
+			return c.result(nil, 0, 0, &fs.PathError{Op: "verify", Path: link, Err: ErrSymlink})
+		}
+	}
+	var info fs.FileInfo
+	if opts.Cache != nil && opts.Open == nil {
+		info, _ = c.Stat() // errors are reported by reading the file
+		if info != nil && opts.Cache.lookup(c, info, opts.Polynomial) {
+			return c.cached(info)
+		}
+	}
+	var reads int64
+	if opts.Stats != nil {
+		opts.reads = &reads
+	}
+	start := time.Now()
+	var h hash.Hash
+	var n int64
+	var err error
+	if opts.FileTimeout > 0 {
+		h, n, err = c.hashWithTimeout(ctx, opts)
+	} else {
+		h, n, err = c.hash(ctx, opts)
+	}
+	result := c.result(h, n, time.Since(start), err)
+	if opts.Stats != nil {
+		result.Reads = atomic.LoadInt64(&reads)
+		opts.Stats.add(result.Reads, result.Bytes)
+	}
+	if opts.Cache != nil && opts.Open == nil {
+		if result.OK && info != nil {
+			opts.Cache.store(c, info, opts.Polynomial)
+		} else {
+			opts.Cache.forget(c)
+		}
+	}
+	if opts.Open == nil {
+		if info, err := c.Stat(); err == nil {
+			result.Size, result.ModTime = info.Size(), info.ModTime()
+		}
+	}
+	if opts.SearchMoved && opts.Open == nil && os.IsNotExist(err) {
+		if moved, ok := c.findMoved(ctx, opts); ok {
+			return moved
+		}
+	}
+	return result
+}
+
+// hash reads the associated file, or opens it with opts.Open, retrying as
+// configured by opts, and returns its hash along with the number of bytes read.
+func (c *Checksum) hash(ctx context.Context, opts VerifyOptions) (h hash.Hash, n int64, err error) {
+	err = retry(ctx, opts.Retries, opts.RetryDelay, func() (err error) {
+		if opts.Open != nil {
+			h, n, err = c.sumOpened(ctx, c.Algorithm, opts)
+		} else {
+			h, n, err = c.sum(ctx, c.Algorithm, opts)
+		}
+		return err
+	})
+	return h, n, err
+}
+
+// hashWithTimeout is like hash, but gives up with ErrFileTimeout once
+// opts.FileTimeout has passed. As a Read blocked on a failing drive can't be
+// interrupted, the file is read in a goroutine of its own, which is left
+// behind to finish or fail on its own when the deadline passes.
+func (c *Checksum) hashWithTimeout(ctx context.Context, opts VerifyOptions) (hash.Hash, int64, error) {
+	fileCtx, cancel := context.WithTimeout(ctx, opts.FileTimeout)
+	defer cancel()
+	type sum struct {
+		h   hash.Hash
+		n   int64
+		err error
+	}
+	done := make(chan sum, 1)
+	checksum := *c // the caller may reuse c once we return
+	go func() {
+		h, n, err := checksum.hash(fileCtx, opts)
+		done <- sum{h, n, err}
+	}()
+	select {
+	case s := <-done:
+		if s.err != nil && ctx.Err() == nil && fileCtx.Err() != nil {
+			return nil, s.n, &fs.PathError{Op: "verify", Path: c.Path, Err: ErrFileTimeout}
+		}
+		return s.h, s.n, s.err
+	case <-fileCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, &fs.PathError{Op: "verify", Path: c.Path, Err: ErrFileTimeout}
+	}
+}
+
+// symlink returns the first path that is a symlink among the directories
+// c.Filename descends through below the directory it is relative to, and
+// the file itself, so that "link/secret" can't escape the manifest's
+// directory through a symlinked "link".
+func (c *Checksum) symlink() (string, bool) {
+	p := filepath.ToSlash(c.Path)
+	rel := strings.TrimPrefix(path.Clean(filepath.ToSlash(c.Filename)), "/")
+	if p != rel && !strings.HasSuffix(p, "/"+rel) {
+		// the path wasn't built from the filename, e.g. by SearchMoved
+		rel = path.Base(p)
+	}
+	dir := strings.TrimSuffix(p, rel)
+	for _, part := range strings.Split(rel, "/") {
+		dir = path.Join(dir, part)
+		info, err := os.Lstat(filepath.FromSlash(dir))
+		if err != nil {
+			return "", false // reported when the file is read
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return filepath.FromSlash(dir), true
+		}
+	}
+	return "", false
+}
+
+// errFound stops the walk in findMoved.
+var errFound = errors.New("found")
+
+// findMoved walks the directory c.Filename is relative to looking for a file
+// with the same base name that matches the checksum, and returns the result
+// of verifying the first match.
+func (c *Checksum) findMoved(ctx context.Context, opts VerifyOptions) (VerifyResult, bool) {
+	root := filepath.Dir(c.Path)
+	if p := filepath.ToSlash(c.Path); strings.HasSuffix(p, "/"+c.Filename) {
+		root = filepath.FromSlash(strings.TrimSuffix(p, "/"+c.Filename))
+	}
+	opts.SearchMoved = false
+	name := path.Base(c.Filename)
+	var found VerifyResult
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable directories
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != name {
+			return nil
+		}
+		candidate := *c
+		candidate.Path = p
+		if r := candidate.verifyWithOptions(ctx, opts); r.OK {
+			r.MovedTo = p
+			found = r
+			return errFound
+		}
+		return nil
+	})
+	return found, err == errFound
+}
+
+// retry calls f until it succeeds, fails with an error that isn't transient,
+// or has been retried retries times, sleeping delay before the first retry and
+// doubling it after each attempt.
+func retry(ctx context.Context, retries int, delay time.Duration, f func() error) error {
+	err := f()
+	for i := 0; i < retries && isTransient(err); i++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		delay *= 2
+		err = f()
+	}
+	return err
+}
+
+// isTransient reports whether err is an I/O error worth retrying. Errors such
+// as a missing file are permanent.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EAGAIN)
+}
+
+// result compares the digest computed by h over n bytes against the expected
+// digest. h is ignored if err is non-nil.
+func (c *Checksum) result(h hash.Hash, n int64, elapsed time.Duration, err error) VerifyResult {
+	result := VerifyResult{
+		Filename:       c.Filename,
+		Expected:       c.CRC32,
+		ExpectedDigest: c.expectedDigest(),
+		Bytes:          n,
+		Elapsed:        elapsed,
+	}
+	if err == nil && n < c.Size {
+		err = &TruncatedError{Filename: c.Filename, Size: n, Expected: c.Size}
+	}
+	if err != nil && c.Original != "" {
+		err = &SanitizedError{Original: c.Original, Sanitized: c.Filename, Err: err}
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if h32, ok := h.(hash.Hash32); ok {
+		result.Computed = h32.Sum32()
+	}
+	result.ComputedDigest = h.Sum(nil)
+	result.OK = bytes.Equal(result.ComputedDigest, result.ExpectedDigest)
+	return result
+}
+
+// cached returns the result of a file that VerifyOptions.Cache holds, which
+// is OK without having been read.
+func (c *Checksum) cached(info fs.FileInfo) VerifyResult {
+	expected := c.expectedDigest()
+	return VerifyResult{
+		Filename:       c.Filename,
+		Expected:       c.CRC32,
+		Computed:       c.CRC32,
+		ExpectedDigest: expected,
+		ComputedDigest: expected,
+		OK:             true,
+		Size:           info.Size(),
+		ModTime:        info.ModTime(),
+		Cached:         true,
+	}
+}
+
+// Compute calculates the CRC32 of the associated file, regardless of the
+// expected value or the algorithm the checksum was read with.
+func (c *Checksum) Compute(polynomial uint32) (uint32, error) {
+	h, _, err := c.sum(context.Background(), CRC32, VerifyOptions{Polynomial: polynomial})
+	if err != nil {
+		return 0, err
+	}
+	return h.(hash.Hash32).Sum32(), nil
+}
+
+// sum streams the associated file through a new hash of the given algorithm
+// and returns it along with the number of bytes read. Only the Polynomial,
+// Limiter and buf fields of opts are used.
+func (c *Checksum) sum(ctx context.Context, algorithm HashAlgorithm, opts VerifyOptions) (hash.Hash, int64, error) {
+	f, err := openFile(c.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	h := algorithm.New(opts.Polynomial)
+	r := countReads(f, opts.reads)
+	var n int64
+	if opts.buf != nil {
+		n, err = hashBuffer(ctx, opts.Limiter.reader(ctx, r), h, opts.buf)
+	} else if size := adaptiveSize(f); size > 0 {
+		n, err = hashBuffer(ctx, opts.Limiter.reader(ctx, r), h, make([]byte, size))
+	} else if isSmall(f) {
+		// a single read into a pooled buffer, skipping bufio's allocation
+		n, err = hashReader(ctx, opts.Limiter.reader(ctx, r), h)
+	} else {
+		n, err = hashReader(ctx, opts.Limiter.reader(ctx, bufio.NewReader(r)), h)
+	}
+	if err != nil {
+		return nil, n, err
+	}
+	return h, n, nil
+}
+
+// sumOpened is like sum, but reads the file through open.
+func (c *Checksum) sumOpened(ctx context.Context, algorithm HashAlgorithm, opts VerifyOptions) (hash.Hash, int64, error) {
+	rc, err := opts.Open(c.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	h := algorithm.New(opts.Polynomial)
+	r := countReads(rc, opts.reads)
+	var n int64
+	if opts.buf != nil {
+		n, err = hashBuffer(ctx, opts.Limiter.reader(ctx, r), h, opts.buf)
+	} else {
+		n, err = hashReader(ctx, opts.Limiter.reader(ctx, r), h)
+	}
+	if err != nil {
+		return nil, n, err
+	}
+	return h, n, nil
+}
+
+// openFile opens the file at path for reading, failing with ErrIsDir for
+// directories, which can be opened but fail with a less helpful EISDIR when
+// read.
+func openFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "verify", Path: path, Err: ErrIsDir}
+	}
+	return f, nil
+}
+
+// adaptiveSize returns the adaptive read buffer size for f, or 0 if adaptive
+// sizing is disabled or f can't be stat'ed.
+func adaptiveSize(f *os.File) int {
+	if atomic.LoadUint64(&adaptiveBufSize) == 0 {
+		return 0
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return fileBufSize(info.Size())
+}
+
+// readSmallFilesAtOnce enables the fast path for small files in sum. It is
+// only turned off to benchmark against the buffered path.
+var readSmallFilesAtOnce = true
+
+// isSmall reports whether f is a regular file smaller than the read buffer,
+// which sum then reads with a single read and hashes in one shot, as going
+// through bufio costs more than reading such files for manifests of many
+// tiny files.
+func isSmall(f *os.File) bool {
+	if !readSmallFilesAtOnce {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular() && uint64(info.Size()) < GetBufSize()
+}
+
+// VerifyReader is like Verify, but hashes the content read from r instead of
+// opening the associated file. This allows verifying data that isn't a plain
+// file on disk, such as a member of an archive.
+func (c *Checksum) VerifyReader(r io.Reader, polynomial uint32) (bool, uint32, error) {
+	result := c.verifyReader(r, polynomial)
+	return result.OK, result.Computed, result.Err
+}
+
+// verifyReader implements VerifyReader, returning the full VerifyResult.
+func (c *Checksum) verifyReader(r io.Reader, polynomial uint32) VerifyResult {
+	start := time.Now()
+	h := c.Algorithm.New(polynomial)
+	n, err := hashReader(context.Background(), r, h)
+	return c.result(h, n, time.Since(start), err)
+}
+
+// sameContent returns the result of verifying c against the content that
+// produced r, the result of verifying another checksum of the same file, so
+// that files listed more than once are only read once.
+func (c *Checksum) sameContent(r VerifyResult) VerifyResult {
+	r.Filename, r.Expected, r.ExpectedDigest = c.Filename, c.CRC32, c.expectedDigest()
+	if r.Err == nil {
+		r.OK = bytes.Equal(r.ComputedDigest, r.ExpectedDigest)
+	}
+	return r
+}
+
+// VerifyAndPromote verifies the staged file at c.Path and, only if it
+// matches, renames it to finalPath, e.g. once a download completes. On a
+// mismatch or error the staged file is left in place and an error is
+// returned.
+func VerifyAndPromote(c Checksum, finalPath string, polynomial uint32) error {
+	r := c.VerifyResult(polynomial)
+	if r.Err != nil {
+		return r.Err
+	}
+	if !r.OK {
+		return fmt.Errorf("corruption: expected %s but computed %s for %s", r.ExpectedHex(), r.ComputedHex(), c.Path)
+	}
+	return os.Rename(c.Path, finalPath)
+}
+
+// VerifyPrefix computes the CRC32 of at most the first n bytes of the
+// associated file, as a fast but weaker spot-check of large files. It doesn't
+// compare against the expected checksum, which covers the whole file; the
+// partial CRC and the number of bytes read are returned for the caller to
+// compare, e.g. against a VerifyPrefix of a known good copy.
+func (c *Checksum) VerifyPrefix(n int64, polynomial uint32) (uint32, int64, error) {
+	f, err := openFile(c.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.New(crcTable(polynomial))
+	read, err := hashReader(context.Background(), io.LimitReader(f, n), h)
+	if err != nil {
+		return 0, read, err
+	}
+	return h.Sum32(), read, nil
+}
+
+// VerifyMulti reads the associated file once, computing its CRC32 with every
+// polynomial in polynomials, and returns the computed values keyed by
+// polynomial. This avoids reading the file again when e.g. both the CRC-32C
+// and the IEEE CRC are needed.
+func (c *Checksum) VerifyMulti(polynomials []uint32) (map[uint32]uint32, error) {
+	f, err := openFile(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hashes := make(map[uint32]hash.Hash32, len(polynomials))
+	writers := make([]io.Writer, 0, len(polynomials))
+	for _, p := range polynomials {
+		if _, ok := hashes[p]; ok {
+			continue
+		}
+		h := crc32.New(crcTable(p))
+		hashes[p] = h
+		writers = append(writers, h)
+	}
+	if _, err := hashReader(context.Background(), bufio.NewReader(f), io.MultiWriter(writers...)); err != nil {
+		return nil, err
+	}
+	computed := make(map[uint32]uint32, len(hashes))
+	for p, h := range hashes {
+		computed[p] = h.Sum32()
+	}
+	return computed, nil
+}
+
+// hashReader writes everything read from r to h and returns the number of
+// bytes read. It returns ctx.Err() as soon as ctx is cancelled.
+func hashReader(ctx context.Context, r io.Reader, h io.Writer) (int64, error) {
+	bp := getBuf()
+	defer putBuf(bp)
+	return hashBuffer(ctx, r, h, *bp)
+}
+
+// maxEmptyReads bounds the number of consecutive reads returning no data and
+// no error before hashBuffer gives up with io.ErrNoProgress, like bufio.
+const maxEmptyReads = 100
+
+// hashBuffer is like hashReader, but reads into buf. Only io.EOF ends the
+// input: a read returning no data and no error is retried rather than taken
+// as the end of the file.
+func hashBuffer(ctx context.Context, r io.Reader, h io.Writer, buf []byte) (int64, error) {
+	var total int64
+	for empty := 0; ; {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			total += int64(n)
+			empty = 0
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			if empty++; empty >= maxEmptyReads {
+				return total, io.ErrNoProgress
+			}
+		}
+	}
+}
+
+// IsExist returns a boolean indicating if the file associated with the checksum
+// exists
+func (c *Checksum) IsExist() bool {
+	_, err := c.Stat()
+	return err == nil
+}
+
+// Stat returns the os.FileInfo of the associated file, following symlinks, so
+// that callers can compare its size, mode or modification time against their
+// own records, since the checksum only covers the content.
+func (c *Checksum) Stat() (os.FileInfo, error) {
+	return os.Stat(c.Path)
+}
+
+// Entry describes a checksum listed in a SFV and whether its file exists.
+type Entry struct {
+	Checksum
+	Exists bool
+}
+
+// List returns an Entry for every checksum in SFV without hashing any files.
+func (s *SFV) List() []Entry {
+	entries := make([]Entry, len(s.Checksums))
+	for i, c := range s.Checksums {
+		entries[i] = Entry{Checksum: c, Exists: c.IsExist()}
+	}
+	return entries
+}
+
+// Verify verifies all checksums contained in SFV and returns true if all
+// checksums are correct.
+func (s *SFV) Verify(polynomial uint32) (bool, error) {
+	return s.VerifyContext(context.Background(), polynomial)
+}
+
+// VerifyContext is like Verify, but aborts verification and returns ctx.Err()
+// as soon as ctx is cancelled.
+func (s *SFV) VerifyContext(ctx context.Context, polynomial uint32) (bool, error) {
+	return s.verify(ctx, polynomial, nil)
+}
+
+// VerifyIn is like Verify, but resolves each filename relative to baseDir
+// instead of using the Path stored when the SFV was read.
+func (s *SFV) VerifyIn(baseDir string, polynomial uint32) (bool, error) {
+	return s.in(baseDir).Verify(polynomial)
+}
+
+// VerifyExisting is like Verify, but skips checksums whose file doesn't exist,
+// which is useful when resuming a partial download. It returns the number of
+// files verified and skipped. If no file exists, nothing is verified and true
+// is returned.
+func (s *SFV) VerifyExisting(polynomial uint32) (ok bool, verified, skipped int, err error) {
+	if len(s.Checksums) == 0 {
+		return false, 0, 0, s.errEmpty()
+	}
+	present := s.Existing()
+	verified = len(present.Checksums)
+	skipped = len(s.Checksums) - verified
+	if verified == 0 {
+		return true, 0, skipped, nil
+	}
+	ok, err = present.Verify(polynomial)
+	return ok, verified, skipped, err
+}
+
+// Existing returns a copy of SFV without the checksums whose file doesn't
+// exist, the files VerifyExisting and VerifyOptions.SkipMissing verify.
+func (s *SFV) Existing() *SFV {
+	return s.Filter(func(c Checksum) bool { return c.IsExist() })
+}
+
+// VerifyChangedSince is like Verify, but skips files last modified before t,
+// e.g. the time of the last successful verification, so that periodic scans
+// of a large archive only read what changed. Missing files are not skipped.
+// It returns the number of files verified and skipped.
+func (s *SFV) VerifyChangedSince(t time.Time, polynomial uint32) (ok bool, verified, skipped int, err error) {
+	if len(s.Checksums) == 0 {
+		return false, 0, 0, s.errEmpty()
+	}
+	changed := s.ChangedSince(t)
+	verified = len(changed.Checksums)
+	skipped = len(s.Checksums) - verified
+	if verified == 0 {
+		return true, 0, skipped, nil
+	}
+	ok, err = changed.Verify(polynomial)
+	return ok, verified, skipped, err
+}
+
+// ChangedSince returns a new SFV without the checksums of files last modified
+// before t. Files that can't be stat'ed are kept so that verifying reports
+// them.
+func (s *SFV) ChangedSince(t time.Time) *SFV {
+	return s.Filter(func(c Checksum) bool {
+		info, err := os.Stat(c.Path)
+		return err != nil || !info.ModTime().Before(t)
+	})
+}
+
+// in returns a copy of s with all checksum paths resolved relative to dir.
+func (s *SFV) in(dir string) *SFV {
+	moved := &SFV{Path: s.Path, Checksums: make([]Checksum, len(s.Checksums)), Algorithm: s.Algorithm, Polynomial: s.Polynomial}
+	for i, c := range s.Checksums {
+		c.Path = filepath.Join(dir, filepath.FromSlash(c.Filename))
+		moved.Checksums[i] = c
+	}
+	return moved
+}
+
+// VerifyWithProgress is like Verify, but calls progress after each file has
+// been verified with the number of files done so far and the total number of
+// files. done increases by one with every call.
+func (s *SFV) VerifyWithProgress(polynomial uint32, progress func(done, total int)) (bool, error) {
+	return s.verify(context.Background(), polynomial, progress)
+}
+
+func (s *SFV) verify(ctx context.Context, polynomial uint32, progress func(done, total int)) (bool, error) {
+	if len(s.Checksums) == 0 {
+		return false, s.errEmpty()
+	}
+	polynomial = s.polynomial(polynomial)
+	for i, c := range s.Checksums {
+		ok, _, err := c.VerifyContext(ctx, polynomial)
+		if progress != nil {
+			progress(i+1, len(s.Checksums))
+		}
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Summary groups the results of verifying a SFV by outcome.
+type Summary struct {
+	OK      []VerifyResult
+	Missing []VerifyResult
+	Corrupt []VerifyResult
+	Failed  []VerifyResult // files that could not be read for other reasons
+}
+
+// Status values describing the outcome of a VerifyResult.
+const (
+	StatusOK        = "ok"
+	StatusMissing   = "missing"
+	StatusCorrupt   = "corrupt"
+	StatusTruncated = "truncated"
+	StatusFailed    = "failed"
+)
+
+// Status returns one of StatusOK, StatusMissing, StatusCorrupt,
+// StatusTruncated or StatusFailed depending on the outcome of the
+// verification.
+func (r VerifyResult) Status() string {
+	var truncated *TruncatedError
+	switch {
+	case r.Err == nil && r.OK:
+		return StatusOK
+	case r.Err == nil:
+		return StatusCorrupt
+	case errors.As(r.Err, &truncated):
+		return StatusTruncated
+	case errors.Is(r.Err, fs.ErrNotExist):
+		return StatusMissing
+	default:
+		return StatusFailed
+	}
+}
+
+// Add records r in the category matching its outcome. Truncated files are
+// counted as corrupt.
+func (s *Summary) Add(r VerifyResult) {
+	switch r.Status() {
+	case StatusOK:
+		s.OK = append(s.OK, r)
+	case StatusCorrupt, StatusTruncated:
+		s.Corrupt = append(s.Corrupt, r)
+	case StatusMissing:
+		s.Missing = append(s.Missing, r)
+	default:
+		s.Failed = append(s.Failed, r)
+	}
+}
+
+// Bytes returns the total number of bytes read across all results.
+func (s Summary) Bytes() int64 {
+	var total int64
+	for _, results := range [][]VerifyResult{s.OK, s.Missing, s.Corrupt, s.Failed} {
+		for _, r := range results {
+			total += r.Bytes
+		}
+	}
+	return total
+}
+
+// String returns a tally such as "3 ok, 1 missing, 2 corrupt".
+func (s Summary) String() string {
+	tally := fmt.Sprintf("%d ok, %d missing, %d corrupt", len(s.OK), len(s.Missing), len(s.Corrupt))
+	if len(s.Failed) > 0 {
+		tally += fmt.Sprintf(", %d failed", len(s.Failed))
+	}
+	return tally
+}
+
+// VerifyAll verifies every checksum contained in SFV, continuing past missing
+// and corrupt files, and returns a Summary of the results.
+func (s *SFV) VerifyAll(polynomial uint32) Summary {
+	var summary Summary
+	for _, c := range s.Checksums {
+		summary.Add(c.VerifyResult(polynomial))
+	}
+	return summary
 }
 
-// SFV contains all the checksums read from a SFV file.
-type SFV struct {
-	Checksums []Checksum
-	Path      string
+// Categorize is like VerifyAll, but uses the polynomial recorded for s when
+// polynomial is Auto and returns an error if SFV is empty. Files that exist
+// but can't be read are in the Failed bucket, one result per file. Verify
+// succeeding is equivalent to every result being in the OK bucket.
+func (s *SFV) Categorize(polynomial uint32) (Summary, error) {
+	if len(s.Checksums) == 0 {
+		return Summary{}, s.errEmpty()
+	}
+	return s.VerifyAll(s.polynomial(polynomial)), nil
 }
 
-var bufSize uint64 = 4096
+// VerifyConcurrent verifies all checksums contained in SFV using a pool of
+// workers goroutines. It returns true if all checksums are correct, otherwise
+// it returns false along with one error per failed checksum.
+func (s *SFV) VerifyConcurrent(polynomial uint32, workers int) (bool, []error) {
+	if len(s.Checksums) == 0 {
+		return false, []error{s.errEmpty()}
+	}
+	failed := []error{}
+	for r := range s.VerifyStream(polynomial, workers) {
+		if r.Err != nil {
+			failed = append(failed, r.Err)
+		} else if !r.OK {
+			failed = append(failed, errors.New(r.Problem()))
+		}
+	}
+	return len(failed) == 0, failed
+}
 
-func SetBufSize(bs int) {
-	atomic.SwapUint64(&bufSize, uint64(bs))
+// VerifyStream verifies all checksums contained in SFV using a pool of
+// workers goroutines and returns a channel delivering each result as soon as
+// it completes. The channel is closed once every checksum has been verified.
+// Callers must drain the channel and must not modify s until it is closed.
+func (s *SFV) VerifyStream(polynomial uint32, workers int) <-chan VerifyResult {
+	return s.VerifyStreamContext(context.Background(), polynomial, workers)
 }
 
-func GetBufSize() uint64 {
-	return atomic.LoadUint64(&bufSize)
+// VerifyStreamContext is like VerifyStream, but stops handing out checksums
+// once ctx is cancelled. Results of files being read at that point carry
+// ctx.Err().
+func (s *SFV) VerifyStreamContext(ctx context.Context, polynomial uint32, workers int) <-chan VerifyResult {
+	return s.stream(ctx, VerifyOptions{Polynomial: polynomial, Workers: workers, FollowSymlinks: true})
 }
 
-// Verify calculates the CRC32 of the associated file and returns true if the
-// checksum is correct along with the calculated checksum
-func (c *Checksum) Verify(polynomial uint32) (bool, uint32, error) {
-	f, err := os.Open(c.Path)
-	if err != nil {
-		return false, 0, err
+// largestFirst returns a copy of checksums sorted by file size, largest
+// first. Files that can't be stat'ed come last, keeping manifest order.
+func largestFirst(checksums []Checksum) []Checksum {
+	sizes := make(map[string]int64, len(checksums))
+	for _, c := range checksums {
+		sizes[c.Path] = -1
+		if info, err := os.Stat(c.Path); err == nil {
+			sizes[c.Path] = info.Size()
+		}
 	}
-	defer f.Close()
+	sorted := append([]Checksum(nil), checksums...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sizes[sorted[i].Path] > sizes[sorted[j].Path]
+	})
+	return sorted
+}
 
-	h := crc32.New(crc32.MakeTable(polynomial))
-	reader := bufio.NewReader(f)
-	buf := make([]byte, bufSize)
-	for {
-		n, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
-			return false, 0, err
+// VerifyWithOptions verifies every checksum contained in SFV according to
+// opts, continuing past missing and corrupt files, and returns a Summary of
+// the results. The error is only set if SFV is empty, opts.MemoryBudget is
+// too small or opts.Context was cancelled, in which case the Summary holds
+// the files verified so far.
+func (s *SFV) VerifyWithOptions(opts VerifyOptions) (Summary, error) {
+	var summary Summary
+	if opts.MemoryBudget > 0 {
+		workers, bufSize, err := budgetWorkers(opts.Workers, opts.MemoryBudget)
+		if err != nil {
+			return summary, err
 		}
-		if n == 0 {
-			break
+		opts.Workers, opts.bufSize = workers, bufSize
+	}
+	if len(s.Checksums) == 0 {
+		return summary, s.errEmpty()
+	}
+	sfv := s.prepare(opts)
+	if opts.Report != nil {
+		opts.Report.Skipped += len(s.Checksums) - len(sfv.Checksums)
+	}
+	ctx := opts.context()
+	start := time.Now()
+	for r := range sfv.stream(ctx, opts) {
+		summary.Add(r)
+		if opts.Report != nil {
+			opts.Report.Add(r)
+		}
+		if opts.OnResult != nil {
+			opts.OnResult(r)
+		}
+		if opts.Progress != nil {
+			opts.Progress.Increment()
 		}
-		h.Write(buf[:n])
 	}
-	result := h.Sum32()
+	if opts.Report != nil {
+		opts.Report.Elapsed += time.Since(start)
+	}
+	return summary, ctx.Err()
+}
 
-	return result == c.CRC32, result, nil
+// Progress is notified through VerifyOptions.Progress each time a file has
+// been verified, so that any progress bar library can be plugged in.
+type Progress interface {
+	Increment()
 }
 
-// IsExist returns a boolean indicating if the file associated with the checksum
-// exists
-func (c *Checksum) IsExist() bool {
-	_, err := os.Stat(c.Path)
-	return err == nil
+// budgetWorkers returns the number of workers and their buffer size used to
+// stay within a VerifyOptions.MemoryBudget of budget bytes.
+func budgetWorkers(workers, budget int) (int, int, error) {
+	if budget < MinBufSize {
+		return 0, 0, fmt.Errorf("memory budget of %d bytes is smaller than the minimum buffer size of %d bytes", budget, MinBufSize)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if max := budget / MinBufSize; workers > max {
+		workers = max
+	}
+	return workers, budget / workers, nil
 }
 
-// Verify verifies all checksums contained in SFV and returns true if all
-// checksums are correct.
-func (s *SFV) Verify(polynomial uint32) (bool, error) {
-	if len(s.Checksums) == 0 {
-		return false, fmt.Errorf("no checksums found in %s", s.Path)
+// prepare applies the BaseDir, ResolveFrom and SkipMissing options to SFV.
+func (s *SFV) prepare(opts VerifyOptions) *SFV {
+	sfv := s
+	if opts.BaseDir != "" {
+		sfv = s.in(opts.BaseDir)
+	} else if opts.ResolveFrom == CWD {
+		sfv = s.in(".")
 	}
-	for _, c := range s.Checksums {
-		ok, _, err := c.Verify(polynomial)
-		if err != nil {
-			return false, err
+	if opts.SkipMissing && opts.Open == nil {
+		sfv = sfv.Existing()
+	}
+	return sfv
+}
+
+// stream implements VerifyStreamContext and VerifyWithOptions.
+func (s *SFV) stream(ctx context.Context, opts VerifyOptions) <-chan VerifyResult {
+	opts.Polynomial = s.polynomial(opts.Polynomial)
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	checksums := make(chan Checksum)
+	results := make(chan VerifyResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(opts VerifyOptions) {
+			defer wg.Done()
+			if opts.bufSize > 0 {
+				opts.buf = make([]byte, opts.bufSize)
+			}
+			for c := range checksums {
+				r := c.verifyWithOptions(ctx, opts)
+				if opts.buf != nil && errors.Is(r.Err, ErrFileTimeout) {
+					// the abandoned read may still write to the old buffer
+					opts.buf = make([]byte, opts.bufSize)
+				}
+				results <- r
+			}
+		}(opts)
+	}
+	go func() {
+		defer close(checksums)
+		order := s.Checksums
+		if opts.LargestFirst && opts.Open == nil {
+			order = largestFirst(order)
 		}
-		if !ok {
-			return false, nil
+		for _, c := range order {
+			select {
+			case checksums <- c:
+			case <-ctx.Done():
+				return
+			}
 		}
-	}
-	return true, nil
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
 }
 
 // IsExist returns a boolean if all the files in SFV exists
@@ -102,18 +1479,225 @@ func (s *SFV) IsExist() bool {
 	return true
 }
 
+// ValidateTrailer checks the totals recorded in a trailer comment against the
+// parsed entries, returning an error if they disagree, which usually means the
+// manifest itself was truncated. The byte count is compared against the sizes
+// of the files on disk, so missing files also cause an error. Manifests
+// without a trailer always validate.
+func (s *SFV) ValidateTrailer() error {
+	if s.ExpectedFileCount == 0 && s.ExpectedByteCount == 0 {
+		return nil
+	}
+	if n := int64(len(s.Checksums)); n != s.ExpectedFileCount {
+		return fmt.Errorf("trailer lists %d files but %d were parsed", s.ExpectedFileCount, n)
+	}
+	size, err := s.TotalSize()
+	if err != nil {
+		return err
+	}
+	if size != s.ExpectedByteCount {
+		return fmt.Errorf("trailer lists %d bytes but the files total %d", s.ExpectedByteCount, size)
+	}
+	return nil
+}
+
+// SelfChecksum returns the CRC32 of the raw bytes of the SFV file itself, as
+// read from Path, e.g. to publish alongside a manifest.
+func (s *SFV) SelfChecksum(polynomial uint32) (uint32, error) {
+	c := Checksum{Filename: filepath.Base(s.Path), Path: s.Path}
+	return c.Compute(polynomial)
+}
+
+// ValidateSelfChecksum checks SelfChecksum against the CRC32 stored in the
+// companion file Path+".crc", returning an error if they disagree, which means
+// the manifest was corrupted in transit and its checksums can't be trusted.
+// The companion file holds the CRC32 in hex, optionally preceded by the name
+// of the manifest as in a SFV line. Manifests without a companion file always
+// validate.
+func (s *SFV) ValidateSelfChecksum(polynomial uint32) error {
+	b, err := ioutil.ReadFile(s.Path + ".crc")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return fmt.Errorf("missing CRC32 in %s.crc", s.Path)
+	}
+	field := fields[len(fields)-1]
+	if len(field) > 8 || !isHex(field) {
+		return fmt.Errorf("invalid CRC32 %q in %s.crc", field, s.Path)
+	}
+	expected, err := strconv.ParseUint(field, 16, 32)
+	if err != nil {
+		return err
+	}
+	actual, err := s.SelfChecksum(polynomial)
+	if err != nil {
+		return err
+	}
+	if actual != uint32(expected) {
+		return fmt.Errorf("manifest checksum is %08X but %s.crc lists %08X", actual, s.Path, expected)
+	}
+	return nil
+}
+
+// Filter returns a new SFV with the same Path, Algorithm, Polynomial and Header
+// containing only the checksums for which pred returns true, e.g. to verify
+// only some of the files.
+func (s *SFV) Filter(pred func(Checksum) bool) *SFV {
+	filtered := &SFV{Path: s.Path, Algorithm: s.Algorithm, Polynomial: s.Polynomial, Header: s.Header}
+	for _, c := range s.Checksums {
+		if pred(c) {
+			filtered.Checksums = append(filtered.Checksums, c)
+		}
+	}
+	return filtered
+}
+
+// Deduplicate removes checksums for filenames already listed earlier in SFV,
+// keeping the first entry, so files aren't hashed twice. If a filename is
+// listed with different checksums, the first entry is still kept but a
+// *DuplicateError naming the conflicting filenames is returned.
+func (s *SFV) Deduplicate() error {
+	unique, conflicts := dedupe(s.Checksums, func(c Checksum) string { return c.Filename })
+	s.Checksums = unique
+	if len(conflicts) > 0 {
+		return &DuplicateError{Filenames: conflicts}
+	}
+	return nil
+}
+
+// dedupe removes checksums whose key was already seen earlier in checksums,
+// reusing its backing array, and returns the keys listed again with a
+// different checksum.
+func dedupe(checksums []Checksum, key func(Checksum) string) (unique []Checksum, conflicts []string) {
+	seen := map[string]Checksum{}
+	unique = checksums[:0]
+	for _, c := range checksums {
+		k := key(c)
+		first, ok := seen[k]
+		if !ok {
+			seen[k] = c
+			unique = append(unique, c)
+			continue
+		}
+		if first.Algorithm != c.Algorithm || !bytes.Equal(first.expectedDigest(), c.expectedDigest()) {
+			conflicts = append(conflicts, k)
+		}
+	}
+	return unique, conflicts
+}
+
+// Merge combines sfvs, such as the manifests of every disc of a release, into
+// a single SFV so that they can be verified in one pass. Checksums keep the
+// paths they were read with, and a file listed by several manifests is only
+// verified once. If a file is listed with different checksums, the first entry
+// is kept and a *DuplicateError naming the conflicting paths is returned
+// along with the merged SFV. The Path of the merged SFV is empty, and its
+// Algorithm and Polynomial are those of the first SFV.
+func Merge(sfvs ...*SFV) (*SFV, error) {
+	merged := &SFV{}
+	for i, s := range sfvs {
+		if i == 0 {
+			merged.Algorithm, merged.Polynomial = s.Algorithm, s.Polynomial
+		}
+		merged.Checksums = append(merged.Checksums, s.Checksums...)
+		merged.Warnings = append(merged.Warnings, s.Warnings...)
+	}
+	unique, conflicts := dedupe(merged.Checksums, func(c Checksum) string { return c.Path })
+	merged.Checksums = unique
+	if len(conflicts) > 0 {
+		return merged, &DuplicateError{Filenames: conflicts}
+	}
+	return merged, nil
+}
+
+// Sort orders the checksums in SFV by filename, ignoring case, so that
+// WriteTo and Diff produce the same output regardless of the order files were
+// listed in. Filenames differing only in case are ordered bytewise. The
+// comparison uses simple Unicode case folding and is independent of locale.
+func (s *SFV) Sort() {
+	sort.SliceStable(s.Checksums, func(i, j int) bool {
+		a, b := s.Checksums[i].Filename, s.Checksums[j].Filename
+		if fa, fb := strings.ToLower(a), strings.ToLower(b); fa != fb {
+			return fa < fb
+		}
+		return a < b
+	})
+}
+
+// TotalSize returns the sum of the sizes of all files in SFV. If any file is
+// missing, the size of the remaining files is returned along with an error
+// listing the missing files.
+func (s *SFV) TotalSize() (int64, error) {
+	var total int64
+	var missing []string
+	for _, c := range s.Checksums {
+		fi, err := os.Stat(c.Path)
+		if err != nil {
+			missing = append(missing, c.Filename)
+			continue
+		}
+		total += fi.Size()
+	}
+	if len(missing) > 0 {
+		return total, fmt.Errorf("missing files: %s", strings.Join(missing, ", "))
+	}
+	return total, nil
+}
+
+// statWorkers bounds the number of concurrent os.Stat calls in MissingFiles.
+const statWorkers = 16
+
+// MissingFiles stats every file in SFV concurrently and returns the filenames
+// of those that don't exist, in manifest order. Concurrent stats help on
+// network filesystems where stat latency dominates.
+func (s *SFV) MissingFiles() []string {
+	exists := make([]bool, len(s.Checksums))
+	sem := make(chan struct{}, statWorkers)
+	var wg sync.WaitGroup
+	for i := range s.Checksums {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			exists[i] = s.Checksums[i].IsExist()
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+
+	missing := []string{}
+	for i, ok := range exists {
+		if !ok {
+			missing = append(missing, s.Checksums[i].Filename)
+		}
+	}
+	return missing
+}
+
 func parseChecksum(dir string, line string) (*Checksum, error) {
-	parts := strings.SplitN(line, " ", 2)
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("could not parse checksum: %q", line)
+	// The CRC32 is always the last field, so split on the last space or tab
+	// to allow filenames containing spaces
+	line = stripInlineComment(strings.TrimSpace(line))
+	i := strings.LastIndexAny(line, " \t")
+	if i < 0 {
+		return nil, fmt.Errorf("missing CRC32 for file %q", line)
 	}
-	filename := strings.TrimSpace(parts[0])
+	filename := strings.TrimSpace(line[:i])
 	path := path.Join(dir, filename)
-	crc32, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 16, 32)
+	field := strings.TrimSpace(line[i+1:])
+	// Some tools omit leading zeros, so accept 1 to 8 hex digits
+	if len(field) > 8 || !isHex(field) {
+		return nil, fmt.Errorf("invalid CRC32 %q for file %q", field, filename)
+	}
+	crc32, err := strconv.ParseUint(field, 16, 32)
 	if err != nil {
 		return nil, err
 	}
-	// ParseUint will return error if number exceeds 32 bits
 	return &Checksum{
 		Path:     path,
 		Filename: filename,
@@ -121,57 +1705,472 @@ func parseChecksum(dir string, line string) (*Checksum, error) {
 	}, nil
 }
 
+// stripInlineComment removes a trailing "; comment" from a checksum line such
+// as "file.bin DEADBEEF ; added later". Only a semicolon following a CRC32
+// field starts a comment, so filenames containing " ;" are kept whole, and
+// the line is kept whole if it has no such semicolon. A line such as
+// "Part 1 ; Extras.mkv 12345678" is kept whole too, since its last field is
+// a full 8 digit CRC32 and the one before the semicolon isn't.
+func stripInlineComment(line string) string {
+	for off := 0; ; {
+		i := strings.Index(line[off:], ";")
+		if i < 0 {
+			return line
+		}
+		if off+i == 0 || !isBlank(line[off+i-1]) {
+			off += i + 1
+			continue
+		}
+		if data := strings.TrimSpace(line[:off+i]); endsInCRC(data) {
+			if last := lastField(line); len(last) == 8 && isHex(last) && len(lastField(data)) < 8 {
+				return line
+			}
+			return data
+		}
+		off += i + 1
+	}
+}
+
+// endsInCRC reports whether line ends in a blank followed by 1 to 8 hex
+// digits.
+func endsInCRC(line string) bool {
+	if strings.LastIndexAny(line, " \t") < 0 {
+		return false
+	}
+	field := lastField(line)
+	return len(field) <= 8 && isHex(field)
+}
+
+// lastField returns the part of line after its last blank.
+func lastField(line string) string {
+	return line[strings.LastIndexAny(line, " \t")+1:]
+}
+
+// isBlank reports whether b is a space or a tab.
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+// isHex reports whether s is a non-empty string of hex digits.
+func isHex(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDigestChecksum returns a parser for lines in the format written by GNU
+// md5sum and friends: the hex digest, a space, a mode character (space for
+// text, '*' for binary) and the filename.
+func parseDigestChecksum(algorithm HashAlgorithm) func(dir, line string) (*Checksum, error) {
+	return func(dir string, line string) (*Checksum, error) {
+		i := strings.IndexAny(line, " \t")
+		if i < 0 || i+1 >= len(line) {
+			return nil, errMissingField
+		}
+		digest, err := hex.DecodeString(line[:i])
+		if err != nil {
+			return nil, err
+		}
+		if len(digest) != algorithm.Size() {
+			return nil, fmt.Errorf("invalid %s digest length %d", algorithm, len(digest))
+		}
+		filename := line[i+1:]
+		if filename[0] == ' ' || filename[0] == '*' {
+			filename = filename[1:]
+		}
+		filename = strings.TrimSpace(filename)
+		if len(filename) == 0 {
+			return nil, errMissingField
+		}
+		return &Checksum{
+			Path:      path.Join(dir, filename),
+			Filename:  filename,
+			Algorithm: algorithm,
+			Digest:    digest,
+		}, nil
+	}
+}
+
 func parseChecksums(dir string, r io.Reader) ([]Checksum, error) {
-	checksums := []Checksum{}
+	sfv, sizes, err := parseLines(dir, r, parseChecksum, false)
+	if err != nil {
+		return nil, err
+	}
+	sfv.setSizes(sizes, func(filename string) string { return filename })
+	return sfv.Checksums, nil
+}
+
+func parseDigestChecksums(dir string, r io.Reader, algorithm HashAlgorithm) ([]Checksum, error) {
+	sfv, sizes, err := parseLines(dir, r, parseDigestChecksum(algorithm), false)
+	if err != nil {
+		return nil, err
+	}
+	sfv.setSizes(sizes, func(filename string) string { return filename })
+	return sfv.Checksums, nil
+}
+
+// maxLineLength caps the length of a line in a manifest or list of paths,
+// far beyond any real path but small enough that a corrupt or binary file
+// doesn't exhaust memory.
+const maxLineLength = 1 << 20
+
+// newLineScanner returns a bufio.Scanner splitting r with scanLines and
+// accepting lines of up to maxLineLength bytes, rather than bufio's default of
+// 64 KiB which deeply nested paths can exceed.
+func newLineScanner(r io.Reader) *bufio.Scanner {
 	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if len(line) == 0 || strings.HasPrefix(line, ";") {
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	scanner.Split(scanLines)
+	return scanner
+}
+
+// lineError explains err returned by a scanner from newLineScanner that
+// stopped at line n.
+func lineError(n int, err error) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("line %d is longer than %d bytes: %w", n, maxLineLength, err)
+	}
+	return err
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines, except that "\r\n",
+// "\n" and a lone "\r" (as written on classic Mac OS) all end a line.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// Request more data to find out whether a '\n' follows the '\r'
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// parseLines parses every non-empty, non-comment line in r using parse into a
+// new SFV, along with the totals recorded in comments, and returns the sizes
+// recorded in comments by filename as listed, for setSizes. If lenient is
+// true, lines that fail to parse are added to the SFV's Warnings and skipped
+// instead of failing the whole parse.
+func parseLines(dir string, r io.Reader, parse func(dir, line string) (*Checksum, error), lenient bool) (*SFV, map[string]int64, error) {
+	sfv := &SFV{}
+	checksums := []Checksum{}
+	sizes := map[string]int64{}
+	scanner := newLineScanner(r)
+	body := false // whether a line other than a comment has been seen
+	n := 1
+	for ; scanner.Scan(); n++ {
+		text := scanner.Text()
+		if n == 1 {
+			// Some Windows tools start files with a UTF-8 byte order mark
+			text = strings.TrimPrefix(text, "\uFEFF")
+		}
+		line := strings.TrimSpace(text)
+		if strings.HasPrefix(line, ";") {
+			if filename, size, ok := parseSizeComment(line); ok {
+				sizes[filename] = size
+			} else if files, size, ok := parseTrailerComment(line); ok {
+				sfv.ExpectedFileCount, sfv.ExpectedByteCount = files, size
+			} else if !body {
+				sfv.Header = append(sfv.Header, line)
+			}
 			continue
 		}
-		checksum, err := parseChecksum(dir, line)
+		if len(line) == 0 {
+			continue
+		}
+		body = true
+		checksum, err := parse(dir, line)
+		if err == nil && strings.IndexByte(line, 0) >= 0 {
+			err = errNulByte
+		}
 		if err != nil {
-			return nil, err
+			perr := &ParseError{Line: n, Content: text, Err: err}
+			if !lenient {
+				return nil, nil, perr
+			}
+			sfv.Warnings = append(sfv.Warnings, perr)
+			continue
 		}
 		checksums = append(checksums, *checksum)
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, lineError(n, err)
+	}
+	sfv.Checksums = checksums
+	return sfv, sizes, nil
+}
+
+// setSizes sets the Size of every checksum from sizes, the sizes recorded in
+// comments by filename as listed, after normalizing those filenames with
+// normalize the same way the filenames of s.Checksums were.
+func (s *SFV) setSizes(sizes map[string]int64, normalize func(string) string) {
+	normalized := make(map[string]int64, len(sizes))
+	for filename, size := range sizes {
+		normalized[normalize(filename)] = size
+	}
+	for i, c := range s.Checksums {
+		s.Checksums[i].Size = normalized[c.Filename]
+	}
+}
+
+// trailerComment matches the totals some tools write at the end of a
+// manifest, either "; 3 files, 12345 bytes" or "; 12345 bytes in 3 files".
+var trailerComment = regexp.MustCompile(`^;\s*(?:(\d+) files?,\s*(\d+) bytes|(\d+) bytes in (\d+) files?)\s*$`)
+
+// parseTrailerComment parses a totals comment matched by trailerComment.
+func parseTrailerComment(line string) (files, size int64, ok bool) {
+	m := trailerComment.FindStringSubmatch(line)
+	if m == nil {
+		return 0, 0, false
+	}
+	filesField, bytesField := m[1], m[2]
+	if filesField == "" {
+		filesField, bytesField = m[4], m[3]
+	}
+	files, err := strconv.ParseInt(filesField, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err = strconv.ParseInt(bytesField, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return files, size, true
+}
+
+// parseSizeComment parses the comment lines cksfv and similar tools write
+// before the checksums, recording the size and modification time of each
+// file: "; 1024  12:34.56 2020-01-02 filename".
+func parseSizeComment(line string) (filename string, size int64, ok bool) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, ";"))
+	fields := make([]string, 3)
+	for i := range fields {
+		j := strings.IndexAny(rest, " \t")
+		if j < 0 {
+			return "", 0, false
+		}
+		fields[i], rest = rest[:j], strings.TrimSpace(rest[j:])
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || size < 0 || rest == "" {
+		return "", 0, false
 	}
-	return checksums, nil
+	if _, err := time.Parse("15:04.05", fields[1]); err != nil {
+		return "", 0, false
+	}
+	if _, err := time.Parse("2006-01-02", fields[2]); err != nil {
+		return "", 0, false
+	}
+	return rest, size, true
+}
+
+// ReadOptions configures how checksum files are parsed. The zero value gives
+// the behaviour of Read and ReadFrom.
+type ReadOptions struct {
+	// KeepBackslashes stops backslashes in filenames, as written by Windows
+	// tools, from being treated as path separators.
+	KeepBackslashes bool
+	// Lenient skips lines that can't be parsed, such as trailing metadata
+	// some tools emit, recording them in SFV.Warnings instead of failing.
+	Lenient bool
+	// Charset is the encoding of the file, for older manifests written in
+	// "windows-1252" or "iso-8859-1" rather than UTF-8, the default.
+	Charset string
+	// Sanitize maps or rejects filenames holding characters that Windows
+	// doesn't allow. By default they're kept as listed.
+	Sanitize Sanitize
 }
 
 // Read reads a SFV file from filepath and creates a new SFV containing
-// checksums parsed from the SFV file.
+// checksums parsed from the SFV file. Files with a .md5, .sha1 or .sha256
+// extension are parsed as md5sum, sha1sum or sha256sum output instead.
+// Gzip-compressed files, such as .sfv.gz, are decompressed transparently.
 func Read(filepath string) (*SFV, error) {
+	return ReadWithOptions(filepath, ReadOptions{})
+}
+
+// ReadWithOptions is like Read but parses the file according to opts.
+func ReadWithOptions(filepath string, opts ReadOptions) (*SFV, error) {
 	f, err := os.Open(filepath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	dir := path.Dir(filepath)
-	checksums, err := parseChecksums(dir, f)
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	ext := path.Ext(strings.TrimSuffix(filepath, ".gz"))
+	sfv, err := readFrom(r, path.Dir(filepath), algorithmForExt(ext), opts)
+	if err != nil {
+		return nil, err
+	}
+	sfv.Path = filepath
+	return sfv, nil
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ReadFrom creates a new SFV containing checksums parsed from SFV content read
+// from r. Filenames are resolved relative to dir.
+func ReadFrom(r io.Reader, dir string) (*SFV, error) {
+	return ReadFromWithOptions(r, dir, ReadOptions{})
+}
+
+// ReadFromWithOptions is like ReadFrom but parses the content according to
+// opts.
+func ReadFromWithOptions(r io.Reader, dir string, opts ReadOptions) (*SFV, error) {
+	return readFrom(r, dir, CRC32, opts)
+}
+
+func readFrom(r io.Reader, dir string, algorithm HashAlgorithm, opts ReadOptions) (*SFV, error) {
+	r, err := decodeCharset(r, opts.Charset)
 	if err != nil {
 		return nil, err
 	}
-	return &SFV{
-		Checksums: checksums,
-		Path:      filepath,
-	}, nil
+	parse := parseChecksum
+	if algorithm != CRC32 {
+		parse = parseDigestChecksum(algorithm)
+	}
+	if opts.Sanitize != SanitizeOff {
+		parse = sanitizing(parse, opts.Sanitize)
+	}
+	sfv, sizes, err := parseLines(dir, r, parse, opts.Lenient)
+	if err != nil {
+		return nil, err
+	}
+	sfv.Algorithm = algorithm
+	if !opts.KeepBackslashes {
+		for i, c := range sfv.Checksums {
+			if strings.Contains(c.Filename, "\\") {
+				sfv.Checksums[i].Filename = strings.ReplaceAll(c.Filename, "\\", "/")
+				sfv.Checksums[i].Path = path.Join(dir, sfv.Checksums[i].Filename)
+			}
+		}
+	}
+	sfv.setSizes(sizes, func(filename string) string {
+		if opts.Sanitize != SanitizeOff {
+			filename = sanitizeFilename(filename)
+		}
+		if !opts.KeepBackslashes {
+			filename = strings.ReplaceAll(filename, "\\", "/")
+		}
+		return filename
+	})
+	return sfv, nil
 }
 
 // Find tries to find a SFV file in the given path. If multiple SFV files exist
-// in path, the first one will be returned.
+// in path, the first one in lexical order will be returned. Use FindPaths to
+// get all of them.
 func Find(path string) (*SFV, error) {
+	paths, err := FindPaths(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no sfv found in %s", path)
+	}
+	return Read(paths[0])
+}
+
+// isSFVName reports whether name has a .sfv or .sfv.gz extension, ignoring
+// case as Windows tools often write "RELEASE.SFV".
+func isSFVName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".sfv") || strings.HasSuffix(name, ".sfv.gz")
+}
+
+// FindPaths returns the paths of all SFV files in the given path, sorted
+// lexically. Subdirectories are not searched.
+func FindPaths(path string) ([]string, error) {
 	files, err := ioutil.ReadDir(path)
 	if err != nil {
 		return nil, err
 	}
+	paths := []string{}
 	for _, f := range files {
-		if filepath.Ext(f.Name()) == ".sfv" {
-			return Read(filepath.Join(path, f.Name()))
+		if !f.IsDir() && isSFVName(f.Name()) {
+			paths = append(paths, filepath.Join(path, f.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// FindAll walks the directory tree rooted at root and returns every SFV file
+// found, parsed, in lexical order.
+func FindAll(root string) ([]*SFV, error) {
+	sfvs := []*SFV{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isSFVName(d.Name()) {
+			return nil
 		}
+		sfv, err := Read(p)
+		if err != nil {
+			return err
+		}
+		sfvs = append(sfvs, sfv)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sfvs, nil
+}
+
+// SFVReport is the outcome of verifying one SFV found by WalkAndVerify.
+type SFVReport struct {
+	Path    string
+	Summary Summary
+	Err     error // set if the SFV couldn't be verified, e.g. when empty
+}
+
+// WalkAndVerify finds every SFV file under root like FindAll and verifies
+// each against its sibling files, returning one report per SFV in lexical
+// order. The error is only set if the tree couldn't be walked or an SFV
+// couldn't be parsed.
+func WalkAndVerify(root string, polynomial uint32) ([]SFVReport, error) {
+	sfvs, err := FindAll(root)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]SFVReport, 0, len(sfvs))
+	for _, sfv := range sfvs {
+		summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: polynomial, FollowSymlinks: true})
+		reports = append(reports, SFVReport{Path: sfv.Path, Summary: summary, Err: err})
 	}
-	return nil, fmt.Errorf("no sfv found in %s", path)
+	return reports, nil
 }
@@ -1,16 +1,24 @@
 package verifysfv
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"text/template"
+	"time"
 )
 
 const sfv = `
@@ -76,17 +84,130 @@ func TestParseChecksum(t *testing.T) {
 	}
 }
 
+func TestParseChecksumSpaces(t *testing.T) {
+	line := "file with spaces.bin DEADBEEF"
+	checksum, err := parseChecksum("/tmp", line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "file with spaces.bin"; checksum.Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, checksum.Filename)
+	}
+	if expected := "/tmp/file with spaces.bin"; checksum.Path != expected {
+		t.Fatalf("Expected %q, got %q", expected, checksum.Path)
+	}
+	if expected := uint32(0xDEADBEEF); checksum.CRC32 != expected {
+		t.Fatalf("Expected %d, got %d", expected, checksum.CRC32)
+	}
+}
+
+func TestParseChecksumTabs(t *testing.T) {
+	checksum, err := parseChecksum("/tmp", "file with spaces.bin\t\tDEADBEEF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "file with spaces.bin"; checksum.Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, checksum.Filename)
+	}
+	if expected := uint32(0xDEADBEEF); checksum.CRC32 != expected {
+		t.Fatalf("Expected %d, got %d", expected, checksum.CRC32)
+	}
+
+	sfv, err := Read("testdata/tabs.sfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 2 {
+		t.Fatalf("Expected 2 checksums, got %d", len(sfv.Checksums))
+	}
+	if expected := "bar"; sfv.Checksums[1].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[1].Filename)
+	}
+	if ok, err := sfv.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected tab-separated manifest to verify, got %v", err)
+	}
+}
+
+func TestParseChecksumsLongLine(t *testing.T) {
+	long := strings.Repeat("deeply/nested/", 10000) + "file.bin"
+	checksums, err := parseChecksums("/tmp", strings.NewReader("; header\n"+long+" DEADBEEF\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksums[0].Filename != long {
+		t.Fatalf("Expected a %d byte filename, got %d bytes", len(long), len(checksums[0].Filename))
+	}
+
+	tooLong := strings.Repeat("a", maxLineLength+1)
+	_, err = parseChecksums("/tmp", strings.NewReader("; header\n"+tooLong+" DEADBEEF\n"))
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("Expected %v, got %v", bufio.ErrTooLong, err)
+	}
+	if expected := fmt.Sprintf("line 2 is longer than %d bytes: %v", maxLineLength, bufio.ErrTooLong); err.Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestParseChecksumMissingCRC(t *testing.T) {
+	for _, line := range []string{"file.bin ", "file.bin", "file.bin \t "} {
+		_, err := parseChecksum("/tmp", line)
+		if err == nil {
+			t.Fatalf("Expected error for %q", line)
+		}
+		if expected := `missing CRC32 for file "file.bin"`; err.Error() != expected {
+			t.Fatalf("Expected %q, got %q", expected, err.Error())
+		}
+	}
+	if _, err := parseChecksums("/tmp", strings.NewReader("file.bin \n")); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestParseChecksumShortCRC(t *testing.T) {
+	checksum, err := parseChecksum("/tmp", "file.bin 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum.CRC32 != 0 {
+		t.Fatalf("Expected 0, got %d", checksum.CRC32)
+	}
+	checksum, err = parseChecksum("/tmp", "file.bin 1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint32(0x00001234); checksum.CRC32 != expected {
+		t.Fatalf("Expected %d, got %d", expected, checksum.CRC32)
+	}
+}
+
+func TestParseChecksumInvalidHex(t *testing.T) {
+	for _, crc := range []string{"1_23", "0xFF", "123456789", "+1234", "-1", "DEADBEEG"} {
+		line := "file.bin " + crc
+		if _, err := parseChecksum("/tmp", line); err == nil {
+			t.Fatalf("Expected error for %q", line)
+		}
+		_, err := parseChecksums("/tmp", strings.NewReader(line))
+		if _, ok := err.(*ParseError); !ok {
+			t.Fatalf("Expected *ParseError for %q, got %T: %v", line, err, err)
+		}
+	}
+}
+
 func TestParseChecksums(t *testing.T) {
 	in := "; comment\n" +
 		"file1  9626347b\n" +
 		"file2 04A2B3E7\r\n" +
 		"file3 04A2B3E9\n" +
-		"file4 \t04A2B3E6"
+		"file4 \t04A2B3E6\n" +
+		"my movie file.mkv   abcd1234\n" +
+		"two  spaces.bin    DEADBEEF"
 	out := []Checksum{
 		Checksum{Path: "/tmp/file1", Filename: "file1", CRC32: 0x9626347b},
 		Checksum{Path: "/tmp/file2", Filename: "file2", CRC32: 77771751},
 		Checksum{Path: "/tmp/file3", Filename: "file3", CRC32: 77771753},
 		Checksum{Path: "/tmp/file4", Filename: "file4", CRC32: 77771750},
+		Checksum{Path: "/tmp/my movie file.mkv", Filename: "my movie file.mkv", CRC32: 0xabcd1234},
+		Checksum{Path: "/tmp/two  spaces.bin", Filename: "two  spaces.bin", CRC32: 0xDEADBEEF},
 	}
 	checksums, err := parseChecksums("/tmp", strings.NewReader(in))
 	if err != nil {
@@ -127,6 +248,20 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestReadFrom(t *testing.T) {
+	in := "; comment\nfoo 9626347b\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []Checksum{
+		Checksum{Path: "/data/foo", Filename: "foo", CRC32: 0x9626347b},
+	}
+	if !reflect.DeepEqual(sfv.Checksums, out) {
+		t.Fatalf("Expected %+v, got %+v", out, sfv.Checksums)
+	}
+}
+
 func TestFind(t *testing.T) {
 	dir, err := ioutil.TempDir("", "gosfv")
 	if err != nil {
@@ -151,9 +286,2192 @@ func TestFind(t *testing.T) {
 	}
 }
 
+func TestFindPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"disc2.sfv", "disc1.sfv", "notes.txt", "RELEASE.SFV"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := FindPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "RELEASE.SFV"), filepath.Join(dir, "disc1.sfv"), filepath.Join(dir, "disc2.sfv")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	sfv, err := Find(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sfv.Path != expected[0] {
+		t.Fatalf("Expected %q, got %q", expected[0], sfv.Path)
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{
+		filepath.Join(dir, "a", "b", "disc2.sfv"),
+		filepath.Join(dir, "a", "disc1.sfv"),
+		filepath.Join(dir, "a", "disc3.SFV"),
+		filepath.Join(dir, "top.sfv"),
+	}
+	for _, p := range paths {
+		if err := ioutil.WriteFile(p, []byte("foo 9626347b\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "foo"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sfvs, err := FindAll(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfvs) != len(paths) {
+		t.Fatalf("Expected %d SFV files, got %d", len(paths), len(sfvs))
+	}
+	for i, sfv := range sfvs {
+		if sfv.Path != paths[i] {
+			t.Fatalf("Expected %q, got %q", paths[i], sfv.Path)
+		}
+	}
+}
+
 func TestEmptySFV(t *testing.T) {
 	sfv := SFV{Path: "/tmp/sfv.sfv"}
-	if _, err := sfv.Verify(crc32.Castagnoli); err == nil {
+	if _, err := sfv.Verify(crc32.Castagnoli); !errors.Is(err, ErrEmptySFV) {
+		t.Fatalf("Expected %v, got %v", ErrEmptySFV, err)
+	}
+}
+
+func TestEmptySFVCommentsOnly(t *testing.T) {
+	f, err := tempFile("; Generated by hand\n;\n\n; nothing to see here\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name()) // Ignore error
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 0 {
+		t.Fatalf("Expected no checksums, got %d", len(sfv.Checksums))
+	}
+	if _, err := sfv.Verify(crc32.Castagnoli); !errors.Is(err, ErrEmptySFV) {
+		t.Fatalf("Expected %v, got %v", ErrEmptySFV, err)
+	}
+	_, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if !errors.Is(err, ErrEmptySFV) {
+		t.Fatalf("Expected %v, got %v", ErrEmptySFV, err)
+	}
+	if !strings.Contains(err.Error(), f.Name()) {
+		t.Fatalf("Expected the error to name %q, got %q", f.Name(), err)
+	}
+}
+
+func TestVerifyConcurrent(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	ok, errs := sfv.VerifyConcurrent(crc32.Castagnoli, 4)
+	if !ok {
+		t.Fatalf("Expected true, got false: %v", errs)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("Expected no errors, got %v", errs)
+	}
+
+	// Corrupt one checksum and remove the file of another
+	sfv.Checksums[0].CRC32++
+	os.Remove(sfv.Checksums[1].Path)
+	ok, errs = sfv.VerifyConcurrent(crc32.Castagnoli, 4)
+	if ok {
+		t.Fatal("Expected false, got true")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+}
+
+func TestChecksumVerifyResult(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	c := Checksum{Filename: "foo", Path: f.Name(), CRC32: 0x9626347b}
+	r := c.VerifyResult(crc32.Castagnoli)
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if !r.OK {
+		t.Fatal("Expected true, got false")
+	}
+	if r.Filename != c.Filename {
+		t.Fatalf("Expected %q, got %q", c.Filename, r.Filename)
+	}
+	if r.Computed != r.Expected {
+		t.Fatalf("Expected %x, got %x", r.Expected, r.Computed)
+	}
+	if expected := int64(4); r.Bytes != expected {
+		t.Fatalf("Expected %d bytes, got %d", expected, r.Bytes)
+	}
+	if r.Elapsed <= 0 {
+		t.Fatalf("Expected positive elapsed time, got %s", r.Elapsed)
+	}
+
+	c.Path = f.Name() + ".missing"
+	if r := c.VerifyResult(crc32.Castagnoli); r.Err == nil || r.OK {
+		t.Fatalf("Expected error, got %+v", r)
+	}
+}
+
+func TestVerifyContextCancelled(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := sfv.Checksums[0].VerifyContext(ctx, crc32.Castagnoli); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := sfv.VerifyContext(ctx, crc32.Castagnoli); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestParseMD5Checksums(t *testing.T) {
+	in := "d3b07384d113edec49eaa6238ad5ff00  foo\n" +
+		"c157a79031e1c40f85931829bc5fc552 *bar baz.bin\n"
+	checksums, err := parseDigestChecksums("/tmp", strings.NewReader(in), MD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checksums) != 2 {
+		t.Fatalf("Expected 2 checksums, got %d", len(checksums))
+	}
+	if expected := "bar baz.bin"; checksums[1].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, checksums[1].Filename)
+	}
+	if expected := "/tmp/foo"; checksums[0].Path != expected {
+		t.Fatalf("Expected %s, got %s", expected, checksums[0].Path)
+	}
+	for _, c := range checksums {
+		if c.Algorithm != MD5 {
+			t.Fatalf("Expected %s, got %s", MD5, c.Algorithm)
+		}
+	}
+	if _, err := parseDigestChecksums("/tmp", strings.NewReader("d3b07384  foo"), MD5); err == nil {
 		t.Fatal("Expected error")
 	}
 }
+
+func TestReadMD5(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	md5sum := "d3b07384d113edec49eaa6238ad5ff00  foo\n"
+	md5Path := filepath.Join(dir, "test.md5")
+	if err := ioutil.WriteFile(md5Path, []byte(md5sum), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(md5Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := sfv.Verify(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+	sfv.Checksums[0].Digest[0]++
+	if ok, _ := sfv.Verify(crc32.Castagnoli); ok {
+		t.Fatal("Expected false, got true")
+	}
+}
+
+func TestReadSHA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifests := map[string]string{
+		"test.sha1":   "f1d2d2f924e986ac86fdf7b36c94bcdf32beec15  foo\n",
+		"test.sha256": "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c  foo\n",
+	}
+	for name, content := range manifests {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		sfv, err := Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := algorithmForExt(filepath.Ext(name)); sfv.Checksums[0].Algorithm != expected {
+			t.Fatalf("Expected %s, got %s", expected, sfv.Checksums[0].Algorithm)
+		}
+		ok, err := sfv.Verify(crc32.Castagnoli)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("Expected true for %s, got false", name)
+		}
+	}
+}
+
+func TestParseChecksumsBOM(t *testing.T) {
+	for _, in := range []string{
+		"\xEF\xBB\xBFfile1 9626347b\n",
+		"\xEF\xBB\xBF; comment\nfile1 9626347b\n",
+	} {
+		checksums, err := parseChecksums("/tmp", strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := []Checksum{
+			Checksum{Path: "/tmp/file1", Filename: "file1", CRC32: 0x9626347b},
+		}
+		if !reflect.DeepEqual(checksums, out) {
+			t.Fatalf("Expected %+v, got %+v", out, checksums)
+		}
+	}
+}
+
+func TestParseChecksumsLineEndings(t *testing.T) {
+	out := []Checksum{
+		Checksum{Path: "/tmp/file1", Filename: "file1", CRC32: 0x9626347b},
+		Checksum{Path: "/tmp/file2", Filename: "file2", CRC32: 77771751},
+		Checksum{Path: "/tmp/file3", Filename: "file3", CRC32: 77771753},
+	}
+	for _, in := range []string{
+		"; comment\rfile1 9626347b\rfile2 04A2B3E7\rfile3 04A2B3E9\r",
+		"; comment\r\nfile1 9626347b\r\nfile2 04A2B3E7\r\nfile3 04A2B3E9",
+		"; comment\nfile1 9626347b\r\rfile2 04A2B3E7\r\nfile3 04A2B3E9\n",
+	} {
+		checksums, err := parseChecksums("/tmp", strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(checksums, out) {
+			t.Fatalf("Expected %+v, got %+v for %q", out, checksums, in)
+		}
+	}
+}
+
+func TestScanLinesSplitCRLF(t *testing.T) {
+	// A "\r" at the end of the buffer must wait for more data
+	if advance, token, _ := scanLines([]byte("foo\r"), false); advance != 0 || token != nil {
+		t.Fatalf("Expected request for more data, got %d %q", advance, token)
+	}
+	if advance, token, _ := scanLines([]byte("foo\r"), true); advance != 4 || string(token) != "foo" {
+		t.Fatalf("Expected %q, got %d %q", "foo", advance, token)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	in := "; comment\n" +
+		"file1 9626347b\n" +
+		"\n" +
+		"file2 nothex\n"
+	_, err := parseChecksums("/tmp", strings.NewReader(in))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected *ParseError, got %T: %v", err, err)
+	}
+	if expected := 4; perr.Line != expected {
+		t.Fatalf("Expected line %d, got %d", expected, perr.Line)
+	}
+	if expected := "file2 nothex"; perr.Content != expected {
+		t.Fatalf("Expected %q, got %q", expected, perr.Content)
+	}
+	if perr.Err == nil {
+		t.Fatal("Expected underlying error")
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	sfv.Checksums = append(sfv.Checksums,
+		Checksum{Filename: "missing", Path: sfv.Checksums[0].Path + ".missing"},
+		Checksum{Filename: "corrupt", Path: sfv.Checksums[0].Path, CRC32: 1})
+
+	summary := sfv.VerifyAll(crc32.Castagnoli)
+	if len(summary.OK) != 2 || len(summary.Missing) != 1 || len(summary.Corrupt) != 1 {
+		t.Fatalf("Unexpected summary %s", summary)
+	}
+	if expected := "corrupt"; summary.Corrupt[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.Corrupt[0].Filename)
+	}
+	if status := summary.Missing[0].Status(); status != StatusMissing {
+		t.Fatalf("Expected %q, got %q", StatusMissing, status)
+	}
+	if expected := "2 ok, 1 missing, 1 corrupt"; summary.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.String())
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	sfv.Checksums = append(sfv.Checksums,
+		Checksum{Filename: "missing", Path: sfv.Checksums[0].Path + ".missing"},
+		Checksum{Filename: "corrupt", Path: sfv.Checksums[0].Path, CRC32: 1})
+
+	summary, err := sfv.Categorize(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2 ok, 1 missing, 1 corrupt"; summary.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.String())
+	}
+	if expected := "missing"; summary.Missing[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.Missing[0].Filename)
+	}
+	if expected := "corrupt"; summary.Corrupt[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.Corrupt[0].Filename)
+	}
+
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "dir", Path: dir})
+	summary, err = sfv.Categorize(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Failed) != 1 || !errors.Is(summary.Failed[0].Err, ErrIsDir) {
+		t.Fatalf("Expected one ErrIsDir failure, got %+v", summary.Failed)
+	}
+
+	if _, err := (&SFV{}).Categorize(crc32.Castagnoli); err == nil {
+		t.Fatal("Expected an error for an empty SFV")
+	}
+}
+
+func TestBufPoolResize(t *testing.T) {
+	defer SetBufSize(int(GetBufSize()))
+
+	SetBufSize(1024)
+	b := getBuf()
+	if len(*b) != 1024 {
+		t.Fatalf("Expected %d, got %d", 1024, len(*b))
+	}
+	putBuf(b)
+
+	// Pooled buffers of the old size must not be handed out after a resize
+	SetBufSize(2048)
+	b = getBuf()
+	if len(*b) != 2048 {
+		t.Fatalf("Expected %d, got %d", 2048, len(*b))
+	}
+	putBuf(b)
+}
+
+func TestSetBufSize(t *testing.T) {
+	defer SetBufSize(int(GetBufSize()))
+
+	if err := SetBufSize(8192); err != nil {
+		t.Fatal(err)
+	}
+	for _, bs := range []int{0, -1} {
+		if err := SetBufSize(bs); err == nil {
+			t.Fatalf("Expected error for %d", bs)
+		}
+		if expected := uint64(8192); GetBufSize() != expected {
+			t.Fatalf("Expected %d, got %d", expected, GetBufSize())
+		}
+	}
+	if err := SetBufSize(1); err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(MinBufSize); GetBufSize() != expected {
+		t.Fatalf("Expected %d, got %d", expected, GetBufSize())
+	}
+}
+
+func TestVerifyWithProgress(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	var calls [][2]int
+	ok, err := sfv.VerifyWithProgress(crc32.Castagnoli, func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+	if expected := [][2]int{{1, 2}, {2, 2}}; !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected %v, got %v", expected, calls)
+	}
+}
+
+func TestVerifyIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := ReadFrom(strings.NewReader("foo 9626347b\n"), "/nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sfv.Verify(crc32.Castagnoli); err == nil {
+		t.Fatal("Expected error")
+	}
+	ok, err := sfv.VerifyIn(dir, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+	if expected := "/nonexistent/foo"; sfv.Checksums[0].Path != expected {
+		t.Fatalf("Expected stored path %q to be unchanged, got %q", expected, sfv.Checksums[0].Path)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	// The expected value and algorithm are ignored
+	c := Checksum{Filename: "foo", Path: f.Name(), Algorithm: MD5}
+	crc, err := c.Compute(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint32(0x9626347b); crc != expected {
+		t.Fatalf("Expected %x, got %x", expected, crc)
+	}
+	c.Path = f.Name() + ".missing"
+	if _, err := c.Compute(crc32.Castagnoli); err == nil {
+		t.Fatal("Expected error")
+	}
+}
+
+func TestList(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{Checksums: []Checksum{
+		Checksum{Filename: "foo", Path: f.Name(), CRC32: 1},
+		Checksum{Filename: "missing", Path: f.Name() + ".missing", CRC32: 2},
+	}}
+	entries := sfv.List()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if !entries[0].Exists || entries[1].Exists {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+	if entries[1].Filename != "missing" || entries[1].CRC32 != 2 {
+		t.Fatalf("Unexpected entry %+v", entries[1])
+	}
+}
+
+func TestMissingFiles(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{}
+	expected := []string{}
+	for i := 0; i < 3*statWorkers; i++ {
+		c := Checksum{Filename: fmt.Sprintf("file%d", i), Path: f.Name()}
+		if i%3 == 0 {
+			c.Path += ".missing"
+			expected = append(expected, c.Filename)
+		}
+		sfv.Checksums = append(sfv.Checksums, c)
+	}
+	if missing := sfv.MissingFiles(); !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("Expected %v, got %v", expected, missing)
+	}
+	if sfv.IsExist() {
+		t.Fatal("Expected false, got true")
+	}
+}
+
+func TestTotalSize(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	size, err := sfv.TotalSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := int64(8); size != expected {
+		t.Fatalf("Expected %d, got %d", expected, size)
+	}
+
+	sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "missing", Path: f.Name() + ".missing"})
+	size, err = sfv.TotalSize()
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected error listing missing file, got %v", err)
+	}
+	if expected := int64(8); size != expected {
+		t.Fatalf("Expected %d, got %d", expected, size)
+	}
+}
+
+func TestVerifyConcurrentErrorFormat(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{Checksums: []Checksum{
+		Checksum{Filename: "foo", Path: f.Name(), CRC32: 0xabcd},
+	}}
+	_, errs := sfv.VerifyConcurrent(crc32.Castagnoli, 1)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %v", errs)
+	}
+	expected := "corruption: expected 0000ABCD but computed 9626347B for foo"
+	if errs[0].Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, errs[0].Error())
+	}
+}
+
+func TestVerifyExisting(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{Checksums: []Checksum{
+		Checksum{Filename: "foo", Path: f.Name(), CRC32: 0x9626347b},
+		Checksum{Filename: "missing", Path: f.Name() + ".missing", CRC32: 1},
+	}}
+	ok, verified, skipped, err := sfv.VerifyExisting(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expected true, got false")
+	}
+	if verified != 1 || skipped != 1 {
+		t.Fatalf("Expected 1 verified and 1 skipped, got %d and %d", verified, skipped)
+	}
+
+	sfv.Checksums[0].CRC32++
+	if ok, _, _, _ := sfv.VerifyExisting(crc32.Castagnoli); ok {
+		t.Fatal("Expected false, got true")
+	}
+}
+
+func TestVerifyStream(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{}
+	for i := 0; i < 10; i++ {
+		sfv.Checksums = append(sfv.Checksums,
+			Checksum{Filename: fmt.Sprintf("file%d", i), Path: f.Name(), CRC32: 0x9626347b})
+	}
+	sfv.Checksums[3].CRC32 = 0
+	seen := map[string]bool{}
+	corrupt := 0
+	for r := range sfv.VerifyStream(crc32.Castagnoli, 3) {
+		seen[r.Filename] = true
+		if !r.OK {
+			corrupt++
+		}
+	}
+	if len(seen) != len(sfv.Checksums) {
+		t.Fatalf("Expected %d results, got %d", len(sfv.Checksums), len(seen))
+	}
+	if corrupt != 1 {
+		t.Fatalf("Expected 1 corrupt result, got %d", corrupt)
+	}
+}
+
+func TestVerifyStreamContextCancelled(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := SFV{}
+	for i := 0; i < 100; i++ {
+		sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "foo", Path: f.Name()})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for r := range sfv.VerifyStreamContext(ctx, crc32.Castagnoli, 2) {
+		if r.Err != context.Canceled {
+			t.Fatalf("Expected %v, got %v", context.Canceled, r.Err)
+		}
+	}
+}
+
+func TestVerifyReader(t *testing.T) {
+	c := Checksum{Filename: "foo", Path: "/nonexistent/foo", CRC32: 0x9626347b}
+	ok, result, err := c.VerifyReader(strings.NewReader("foo\n"), crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("Expected true, got false (computed %x)", result)
+	}
+	if ok, _, _ := c.VerifyReader(strings.NewReader("bar\n"), crc32.Castagnoli); ok {
+		t.Fatal("Expected false, got true")
+	}
+}
+
+func TestExpectedHex(t *testing.T) {
+	c := Checksum{Filename: "foo", CRC32: 0xABCDEF}
+	if expected := "00ABCDEF"; c.ExpectedHex() != expected {
+		t.Fatalf("Expected %q, got %q", expected, c.ExpectedHex())
+	}
+	c = Checksum{Filename: "foo", Algorithm: MD5, Digest: []byte{0x0d, 0x3b, 0x07}}
+	if expected := "0D3B07"; c.ExpectedHex() != expected {
+		t.Fatalf("Expected %q, got %q", expected, c.ExpectedHex())
+	}
+
+	c = Checksum{Filename: "foo", Path: "/nonexistent/foo", CRC32: 0x0626347b}
+	r := c.verifyReader(strings.NewReader("foo\n"), crc32.Castagnoli)
+	if r.ExpectedHex() != "0626347B" || r.ComputedHex() != "9626347B" {
+		t.Fatalf("Expected 0626347B and 9626347B, got %s and %s", r.ExpectedHex(), r.ComputedHex())
+	}
+	if r := c.VerifyResult(crc32.Castagnoli); r.ComputedHex() != "" {
+		t.Fatalf("Expected no computed checksum for a missing file, got %q", r.ComputedHex())
+	}
+}
+
+func TestSort(t *testing.T) {
+	expected := []string{"a.bin", "B.bin", "b.bin", "c/d.bin", "Zeta.bin"}
+	for _, order := range [][]string{
+		{"Zeta.bin", "b.bin", "c/d.bin", "B.bin", "a.bin"},
+		{"c/d.bin", "B.bin", "a.bin", "Zeta.bin", "b.bin"},
+	} {
+		sfv := SFV{}
+		for _, name := range order {
+			sfv.Checksums = append(sfv.Checksums, Checksum{Filename: name})
+		}
+		sfv.Sort()
+		for i, c := range sfv.Checksums {
+			if c.Filename != expected[i] {
+				t.Fatalf("Expected %q at %d, got %q", expected[i], i, c.Filename)
+			}
+		}
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	in := "file1 9626347b\n" +
+		"file2 fb1d06c8\n" +
+		"file1 9626347B\n" +
+		"file3 00000001\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sfv.Deduplicate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 3 {
+		t.Fatalf("Expected 3 checksums, got %+v", sfv.Checksums)
+	}
+
+	sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "file2", CRC32: 2})
+	err = sfv.Deduplicate()
+	derr, ok := err.(*DuplicateError)
+	if !ok {
+		t.Fatalf("Expected *DuplicateError, got %T: %v", err, err)
+	}
+	if expected := []string{"file2"}; !reflect.DeepEqual(derr.Filenames, expected) {
+		t.Fatalf("Expected %v, got %v", expected, derr.Filenames)
+	}
+	if len(sfv.Checksums) != 3 || sfv.Checksums[1].CRC32 != 0xfb1d06c8 {
+		t.Fatalf("Expected first entry to be kept, got %+v", sfv.Checksums)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	disc1, err := ReadFrom(strings.NewReader("file1 9626347b\nshared fb1d06c8\n"), "/tmp/disc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc2, err := ReadFrom(strings.NewReader("file1 00000001\n../disc1/shared FB1D06C8\n"), "/tmp/disc2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := Merge(disc1, disc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, c := range merged.Checksums {
+		paths = append(paths, c.Path)
+	}
+	if expected := []string{"/tmp/disc1/file1", "/tmp/disc1/shared", "/tmp/disc2/file1"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	if merged.Polynomial != disc1.Polynomial {
+		t.Fatalf("Expected %X, got %X", disc1.Polynomial, merged.Polynomial)
+	}
+
+	disc2.Checksums[0].Path = "/tmp/disc1/file1"
+	merged, err = Merge(disc1, disc2)
+	derr, ok := err.(*DuplicateError)
+	if !ok {
+		t.Fatalf("Expected *DuplicateError, got %T: %v", err, err)
+	}
+	if expected := []string{"/tmp/disc1/file1"}; !reflect.DeepEqual(derr.Filenames, expected) {
+		t.Fatalf("Expected %v, got %v", expected, derr.Filenames)
+	}
+	if len(merged.Checksums) != 2 || merged.Checksums[0].CRC32 != 0x9626347b {
+		t.Fatalf("Expected first entry to be kept, got %+v", merged.Checksums)
+	}
+}
+
+func TestParsePolynomial(t *testing.T) {
+	for in, expected := range map[string]uint32{
+		"crc32c":     crc32.Castagnoli,
+		"ieee":       crc32.IEEE,
+		"koop":       crc32.Koopman,
+		"koopman":    crc32.Koopman,
+		"0x82F63B78": crc32.Castagnoli,
+		"edb88320":   crc32.IEEE,
+		"auto":       uint32(Auto),
+	} {
+		p, err := ParsePolynomial(in)
+		if err != nil {
+			t.Fatalf("Expected %q to parse, got %v", in, err)
+		}
+		if p != expected {
+			t.Fatalf("Expected %X for %q, got %X", expected, in, p)
+		}
+	}
+	for _, in := range []string{"", "crc64", "0x", "0x123456789", "0"} {
+		if _, err := ParsePolynomial(in); err == nil {
+			t.Fatalf("Expected an error for %q", in)
+		}
+	}
+}
+
+func TestParseCRC32(t *testing.T) {
+	for in, expected := range map[string]uint32{
+		"DEADBEEF":   0xDEADBEEF,
+		"0xdeadbeef": 0xDEADBEEF,
+		"0XDEADBEEF": 0xDEADBEEF,
+		"1":          1,
+	} {
+		crc, err := ParseCRC32(in)
+		if err != nil {
+			t.Fatalf("Expected %q to parse, got %v", in, err)
+		}
+		if crc != expected {
+			t.Fatalf("Expected %X for %q, got %X", expected, in, crc)
+		}
+	}
+	for _, in := range []string{"", "0x", "123456789", "+1", "xyz"} {
+		if _, err := ParseCRC32(in); err == nil {
+			t.Fatalf("Expected an error for %q", in)
+		}
+	}
+}
+
+func TestVerifyAuto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ieee := crc32.ChecksumIEEE([]byte("foo\n"))
+	manifest := filepath.Join(dir, "foo.sfv")
+	if err := ioutil.WriteFile(manifest, []byte(fmt.Sprintf("foo %08X\n", ieee)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sfv.Algorithm != CRC32 || sfv.Polynomial != uint32(Auto) {
+		t.Fatalf("Expected crc32 with Auto, got %s with %X", sfv.Algorithm, sfv.Polynomial)
+	}
+	if ok, err := sfv.Verify(uint32(Auto)); !ok || err != nil {
+		t.Fatalf("Expected Auto to verify with IEEE, got %v", err)
+	}
+	if ok, _ := sfv.Verify(crc32.Castagnoli); ok {
+		t.Fatal("Expected an explicit polynomial to take precedence")
+	}
+	sfv.Polynomial = crc32.Castagnoli
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: uint32(Auto)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Corrupt) != 1 {
+		t.Fatalf("Expected Auto to verify with the SFV's polynomial, got %s", summary)
+	}
+
+	md5sums := filepath.Join(dir, "foo.md5")
+	if err := ioutil.WriteFile(md5sums, []byte("d3b07384d113edec49eaa6238ad5ff00  foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if sfv, err = Read(md5sums); err != nil {
+		t.Fatal(err)
+	}
+	if sfv.Algorithm != MD5 {
+		t.Fatalf("Expected %s, got %s", MD5, sfv.Algorithm)
+	}
+}
+
+func BenchmarkVerifyManySmallFiles(b *testing.B) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sfv := &SFV{}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("foo\n"), 0644); err != nil {
+			b.Fatal(err)
+		}
+		sfv.Checksums = append(sfv.Checksums, Checksum{
+			Filename: name,
+			Path:     filepath.Join(dir, name),
+			CRC32:    crc32.Checksum([]byte("foo\n"), crc32.MakeTable(crc32.Koopman)),
+		})
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := sfv.Verify(crc32.Koopman); !ok || err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSmallFiles verifies a manifest of 10k files of 100 bytes each,
+// with or without the fast path for small files.
+func benchmarkSmallFiles(b *testing.B, atOnce bool) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := bytes.Repeat([]byte("x"), 100)
+	sfv := &SFV{}
+	for i := 0; i < 10000; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			b.Fatal(err)
+		}
+		sfv.Checksums = append(sfv.Checksums, Checksum{
+			Filename: name,
+			Path:     filepath.Join(dir, name),
+			CRC32:    crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)),
+		})
+	}
+	defer func(old bool) { readSmallFilesAtOnce = old }(readSmallFilesAtOnce)
+	readSmallFilesAtOnce = atOnce
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := sfv.Verify(crc32.Castagnoli); !ok || err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifySmallFilesAtOnce(b *testing.B) { benchmarkSmallFiles(b, true) }
+
+func BenchmarkVerifySmallFilesBuffered(b *testing.B) { benchmarkSmallFiles(b, false) }
+
+func TestCRCTableCached(t *testing.T) {
+	if crcTable(crc32.Koopman) != crcTable(crc32.Koopman) {
+		t.Fatalf("Expected the same table for repeated lookups")
+	}
+}
+
+func TestParseChecksumInlineComment(t *testing.T) {
+	checksum, err := parseChecksum("/tmp", "file.bin DEADBEEF ; added later")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum.Filename != "file.bin" || checksum.CRC32 != 0xDEADBEEF {
+		t.Fatalf("Expected file.bin DEADBEEF, got %q %X", checksum.Filename, checksum.CRC32)
+	}
+
+	checksum, err = parseChecksum("/tmp", "a ;b.bin 0000ABCD ; note ; more")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a ;b.bin"; checksum.Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, checksum.Filename)
+	}
+
+	// a " ; " in the filename before a hex-looking word isn't a comment
+	checksum, err = parseChecksum("/d", "Part 1 ; Extras.mkv 12345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum.Filename != "Part 1 ; Extras.mkv" || checksum.CRC32 != 0x12345678 {
+		t.Fatalf("Expected Part 1 ; Extras.mkv 12345678, got %q %X", checksum.Filename, checksum.CRC32)
+	}
+
+	// nor is a comment ending in a hex-looking word the CRC32
+	for _, line := range []string{"file.bin DEADBEEF ; added", "file.bin DEADBEEF ; checked 2024"} {
+		checksum, err = parseChecksum("/tmp", line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if checksum.Filename != "file.bin" || checksum.CRC32 != 0xDEADBEEF {
+			t.Fatalf("Expected file.bin DEADBEEF for %q, got %q %X", line, checksum.Filename, checksum.CRC32)
+		}
+	}
+}
+
+func TestReadBackslashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "subdir", "file.bin"), []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := "subdir\\file.bin 9626347B\n"
+
+	sfv, err := ReadFrom(strings.NewReader(in), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "subdir/file.bin"; sfv.Checksums[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[0].Filename)
+	}
+	if ok, err := sfv.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected backslash entry to verify, got %v", err)
+	}
+
+	sfv, err = ReadFromWithOptions(strings.NewReader(in), dir, ReadOptions{KeepBackslashes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "subdir\\file.bin"; sfv.Checksums[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[0].Filename)
+	}
+}
+
+func TestReadSizeCommentNormalized(t *testing.T) {
+	in := ";            4  12:00.00 2020-01-01 dir\\file\n" +
+		";            5  12:00.00 2020-01-01 what?.bin\n" +
+		"dir\\file 9626347B\n" +
+		"what?.bin FB1D06C8\n"
+	sfv, err := ReadFromWithOptions(strings.NewReader(in), "/tmp", ReadOptions{Sanitize: SanitizeReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := sfv.Checksums[0]; c.Filename != "dir/file" || c.Size != 4 {
+		t.Fatalf("Expected dir/file of 4 bytes, got %q of %d", c.Filename, c.Size)
+	}
+	if c := sfv.Checksums[1]; c.Filename != "what_.bin" || c.Size != 5 {
+		t.Fatalf("Expected what_.bin of 5 bytes, got %q of %d", c.Filename, c.Size)
+	}
+
+	sfv, err = ReadFromWithOptions(strings.NewReader(in), "/tmp", ReadOptions{KeepBackslashes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := sfv.Checksums[0]; c.Filename != "dir\\file" || c.Size != 4 {
+		t.Fatalf("Expected dir\\file of 4 bytes, got %q of %d", c.Filename, c.Size)
+	}
+}
+
+func TestParseSizeComment(t *testing.T) {
+	in := ";          4  12:34.56 2020-01-02 file one\n" +
+		"; just a comment\n" +
+		"file one 9626347B\n" +
+		"file2 FB1D06C8\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sfv.Checksums[0].Size != 4 {
+		t.Fatalf("Expected size 4, got %d", sfv.Checksums[0].Size)
+	}
+	if sfv.Checksums[1].Size != 0 {
+		t.Fatalf("Expected unknown size, got %d", sfv.Checksums[1].Size)
+	}
+}
+
+func TestVerifyTruncated(t *testing.T) {
+	file, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	c := Checksum{Filename: "foo", Path: file.Name(), CRC32: 0x9626347b, Size: 1024}
+
+	r := c.VerifyResult(crc32.Castagnoli)
+	if status := r.Status(); status != StatusTruncated {
+		t.Fatalf("Expected %q, got %q", StatusTruncated, status)
+	}
+	expected := "truncated: got 4 of 1024 bytes for foo"
+	if r.Err == nil || r.Err.Error() != expected {
+		t.Fatalf("Expected %q, got %v", expected, r.Err)
+	}
+
+	var summary Summary
+	summary.Add(r)
+	if len(summary.Corrupt) != 1 {
+		t.Fatalf("Expected truncated file to count as corrupt, got %s", summary)
+	}
+
+	c.Size = 4
+	if ok, _, err := c.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected file of the recorded size to verify, got %v", err)
+	}
+}
+
+func TestVerifySymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	c := Checksum{Filename: "link", Path: link, CRC32: 0x9626347b}
+
+	r := c.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, FollowSymlinks: true})
+	if !r.OK || r.Err != nil {
+		t.Fatalf("Expected symlink to be followed, got %v", r.Err)
+	}
+
+	r = c.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if !errors.Is(r.Err, ErrSymlink) {
+		t.Fatalf("Expected ErrSymlink, got %v", r.Err)
+	}
+	if status := r.Status(); status != StatusFailed {
+		t.Fatalf("Expected %q, got %q", StatusFailed, status)
+	}
+}
+
+func TestVerifySymlinkedDirectory(t *testing.T) {
+	outside, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "sub", "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	in := "sub/link/secret 9626347B\n"
+	sfv, err := ReadFrom(strings.NewReader(in), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Failed) != 1 || !errors.Is(summary.Failed[0].Err, ErrSymlink) {
+		t.Fatalf("Expected ErrSymlink for the symlinked directory, got %s", summary)
+	}
+	if expected := "verify " + filepath.Join(dir, "sub", "link") + ": refusing to follow symlink"; summary.Failed[0].Err.Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.Failed[0].Err.Error())
+	}
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, FollowSymlinks: true})
+	if err != nil || len(summary.OK) != 1 {
+		t.Fatalf("Expected the symlink to be followed, got %s, %v", summary, err)
+	}
+}
+
+func TestChecksumStat(t *testing.T) {
+	f, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name()) // Ignore error
+	c := Checksum{Filename: path.Base(f.Name()), Path: f.Name()}
+	info, err := c.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 4 {
+		t.Fatalf("Expected %d, got %d", 4, info.Size())
+	}
+	c.Path += ".missing"
+	if _, err := c.Stat(); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not exist error, got %v", err)
+	}
+}
+
+func TestVerifyDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := Checksum{Filename: "dir", Path: dir, CRC32: 0x9626347b}
+	ok, _, err := c.Verify(crc32.Castagnoli)
+	if ok || !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Expected ErrIsDir, got %v", err)
+	}
+	if expected := "verify " + dir + ": expected file but found directory"; err.Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, err.Error())
+	}
+	if _, _, err := c.VerifyMmap(crc32.Castagnoli); !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Expected ErrIsDir, got %v", err)
+	}
+	if status := c.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli}).Status(); status != StatusFailed {
+		t.Fatalf("Expected %q, got %q", StatusFailed, status)
+	}
+}
+
+func TestSFVVerifyWithOptions(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "missing", Path: "/nonexistent/missing", CRC32: 1})
+
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2 ok, 1 missing, 0 corrupt"; summary.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.String())
+	}
+
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, SkipMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "2 ok, 0 missing, 0 corrupt"; summary.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.String())
+	}
+
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, BaseDir: "/nonexistent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Missing) != 3 {
+		t.Fatalf("Expected every file to be missing under BaseDir, got %s", summary)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Context: ctx}); err != context.Canceled {
+		t.Fatalf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// flakyReader fails with EIO until it has been read failures times.
+type flakyReader struct {
+	failures int
+	r        io.Reader
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.failures > 0 {
+		f.failures--
+		return 0, &os.PathError{Op: "read", Path: "flaky", Err: syscall.EIO}
+	}
+	return f.r.Read(p)
+}
+
+func TestRetry(t *testing.T) {
+	fr := &flakyReader{failures: 2, r: strings.NewReader("foo\n")}
+	attempts := 0
+	c := Checksum{Filename: "flaky", CRC32: 0x9626347b}
+	var ok bool
+	err := retry(context.Background(), 3, time.Millisecond, func() (err error) {
+		attempts++
+		ok, _, err = c.VerifyReader(fr, crc32.Castagnoli)
+		return err
+	})
+	if err != nil || !ok {
+		t.Fatalf("Expected success after retrying, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", attempts)
+	}
+
+	fr = &flakyReader{failures: 5, r: strings.NewReader("foo\n")}
+	err = retry(context.Background(), 2, time.Millisecond, func() (err error) {
+		_, _, err = c.VerifyReader(fr, crc32.Castagnoli)
+		return err
+	})
+	if !errors.Is(err, syscall.EIO) {
+		t.Fatalf("Expected EIO once retries are exhausted, got %v", err)
+	}
+
+	attempts = 0
+	c = Checksum{Filename: "missing", Path: "/nonexistent/missing"}
+	r := c.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Retries: 3})
+	if !os.IsNotExist(r.Err) {
+		t.Fatalf("Expected a missing file error, got %v", r.Err)
+	}
+	err = retry(context.Background(), 3, time.Millisecond, func() error {
+		attempts++
+		return r.Err
+	})
+	if attempts != 1 {
+		t.Fatalf("Expected permanent errors not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestVerifyMulti(t *testing.T) {
+	file, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	c := Checksum{Filename: "foo", Path: file.Name()}
+
+	computed, err := c.VerifyMulti([]uint32{crc32.Castagnoli, crc32.IEEE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint32]uint32{
+		crc32.Castagnoli: 0x9626347b,
+		crc32.IEEE:       crc32.ChecksumIEEE([]byte("foo\n")),
+	}
+	if !reflect.DeepEqual(computed, expected) {
+		t.Fatalf("Expected %X, got %X", expected, computed)
+	}
+
+	// Auto means IEEE without a SFV to resolve it
+	computed, err = c.VerifyMulti([]uint32{uint32(Auto)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if computed[uint32(Auto)] != expected[crc32.IEEE] {
+		t.Fatalf("Expected %X, got %X", expected[crc32.IEEE], computed[uint32(Auto)])
+	}
+
+	c.Path = "/nonexistent/foo"
+	if _, err := c.VerifyMulti([]uint32{crc32.IEEE}); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing file error, got %v", err)
+	}
+}
+
+func TestVerifySearchMoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, sub := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a decoy with the right name but wrong content, and the moved file
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "file.bin"), []byte("bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(dir, "b", "file.bin")
+	if err := ioutil.WriteFile(moved, []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := ReadFrom(strings.NewReader("file.bin 9626347B\n"), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Missing) != 1 {
+		t.Fatalf("Expected file to be missing without SearchMoved, got %s", summary)
+	}
+
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, SearchMoved: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.OK) != 1 {
+		t.Fatalf("Expected moved file to be found, got %s", summary)
+	}
+	if summary.OK[0].MovedTo != moved {
+		t.Fatalf("Expected %q, got %q", moved, summary.OK[0].MovedTo)
+	}
+}
+
+func TestReadGzip(t *testing.T) {
+	sfv, err := Read("testdata/gzipped.sfv.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 2 {
+		t.Fatalf("Expected 2 checksums, got %+v", sfv.Checksums)
+	}
+	if expected := path.Join("testdata", "foo"); sfv.Checksums[0].Path != expected {
+		t.Fatalf("Expected %q, got %q", expected, sfv.Checksums[0].Path)
+	}
+	if ok, err := sfv.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected gzipped manifest to verify, got %v", err)
+	}
+}
+
+func TestChecksumString(t *testing.T) {
+	c := Checksum{Filename: "sub/foo bar", CRC32: 0xabc}
+	if expected := "sub/foo bar 00000ABC"; c.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, c.String())
+	}
+	if expected := "sub/foo bar 00000ABC"; fmt.Sprint(&c) != expected {
+		t.Fatalf("Expected %q, got %q", expected, fmt.Sprint(&c))
+	}
+	c = Checksum{Filename: "foo", Algorithm: MD5, Digest: []byte{0xd3, 0xb0}}
+	if expected := "d3b0  foo"; c.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, c.String())
+	}
+}
+
+func TestVerifyResolveFromCWD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.bin"), []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// the manifest lives elsewhere, so its own directory has no file.bin
+	sfv, err := ReadFrom(strings.NewReader("file.bin 9626347B\n"), "/nonexistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Missing) != 1 {
+		t.Fatalf("Expected file to be missing relative to the SFV, got %s", summary)
+	}
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, ResolveFrom: CWD})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.OK) != 1 {
+		t.Fatalf("Expected file to verify relative to the working directory, got %s", summary)
+	}
+}
+
+func TestAdaptiveBufSize(t *testing.T) {
+	if err := SetAdaptiveBufSize(-1); err == nil {
+		t.Fatal("Expected an error for a negative size")
+	}
+	if err := SetAdaptiveBufSize(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	defer SetAdaptiveBufSize(0)
+	for size, expected := range map[int64]int{
+		0:       MinBufSize,
+		100:     MinBufSize,
+		10000:   10000,
+		1 << 30: 1 << 20,
+	} {
+		if bs := fileBufSize(size); bs != expected {
+			t.Fatalf("Expected %d for a %d byte file, got %d", expected, size, bs)
+		}
+	}
+
+	file, err := tempFile("foo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	c := Checksum{Filename: "foo", Path: file.Name(), CRC32: 0x9626347b}
+	if ok, _, err := c.Verify(crc32.Castagnoli); !ok || err != nil {
+		t.Fatalf("Expected file to verify with adaptive buffers, got %v", err)
+	}
+
+	SetAdaptiveBufSize(0)
+	if bs := fileBufSize(1 << 30); bs != 0 {
+		t.Fatalf("Expected adaptive sizing to be disabled, got %d", bs)
+	}
+}
+
+func TestReadLenient(t *testing.T) {
+	in := "file1 9626347B\n" +
+		"DEADBEEF\n" +
+		"file2 FB1D06C8\n"
+	if _, err := ReadFrom(strings.NewReader(in), "/tmp"); err == nil {
+		t.Fatal("Expected an error in strict mode")
+	}
+	sfv, err := ReadFromWithOptions(strings.NewReader(in), "/tmp", ReadOptions{Lenient: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sfv.Checksums) != 2 {
+		t.Fatalf("Expected 2 checksums, got %+v", sfv.Checksums)
+	}
+	if len(sfv.Warnings) != 1 || sfv.Warnings[0].Line != 2 {
+		t.Fatalf("Expected a warning for line 2, got %v", sfv.Warnings)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	in := "movie.mkv 00000001\n" +
+		"subs/movie.srt 00000002\n" +
+		"extras/bonus.MKV 00000003\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mkv := sfv.Filter(func(c Checksum) bool {
+		return strings.EqualFold(path.Ext(c.Filename), ".mkv")
+	})
+	var names []string
+	for _, c := range mkv.Checksums {
+		names = append(names, c.Filename)
+	}
+	if expected := []string{"movie.mkv", "extras/bonus.MKV"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	if len(sfv.Checksums) != 3 {
+		t.Fatalf("Expected the original SFV to be unchanged, got %+v", sfv.Checksums)
+	}
+	if none := sfv.Filter(func(Checksum) bool { return false }); len(none.Checksums) != 0 {
+		t.Fatalf("Expected no checksums, got %+v", none.Checksums)
+	}
+}
+
+func TestVerifyChangedSince(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	lastRun := time.Now()
+	old := lastRun.Add(-time.Hour)
+	if err := os.Chtimes(sfv.Checksums[0].Path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	sfv.Checksums = append(sfv.Checksums, Checksum{Filename: "missing", Path: "/nonexistent/missing"})
+
+	ok, verified, skipped, err := sfv.VerifyChangedSince(lastRun.Add(-time.Minute), crc32.Castagnoli)
+	if ok || !os.IsNotExist(err) {
+		t.Fatalf("Expected the missing file to be reported, got %v %v", ok, err)
+	}
+	if verified != 2 || skipped != 1 {
+		t.Fatalf("Expected 2 verified and 1 skipped, got %d and %d", verified, skipped)
+	}
+
+	sfv.Checksums = sfv.Checksums[:2]
+	ok, verified, skipped, err = sfv.VerifyChangedSince(lastRun.Add(-time.Minute), crc32.Castagnoli)
+	if !ok || err != nil || verified != 1 || skipped != 1 {
+		t.Fatalf("Expected 1 file verified and 1 skipped, got %v %v %d %d", ok, err, verified, skipped)
+	}
+}
+
+// countingProgress counts calls to Increment.
+type countingProgress int
+
+func (p *countingProgress) Increment() { *p++ }
+
+func TestVerifyWithProgressAndResults(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	var progress countingProgress
+	var results []string
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{
+		Polynomial: crc32.Castagnoli,
+		Workers:    2,
+		Progress:   &progress,
+		OnResult:   func(r VerifyResult) { results = append(results, r.Filename) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.OK) != 2 {
+		t.Fatalf("Expected 2 ok, got %s", summary)
+	}
+	if progress != 2 {
+		t.Fatalf("Expected 2 increments, got %d", progress)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %v", results)
+	}
+}
+
+func TestVerifyConcurrently(t *testing.T) {
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	var wg sync.WaitGroup
+	// room for every error: one per progress call, plus one per verification
+	errs := make(chan error, 8*(len(sfv.Checksums)+1)+8)
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			last := 0
+			ok, err := sfv.VerifyWithProgress(crc32.Castagnoli, func(done, total int) {
+				if done != last+1 {
+					errs <- fmt.Errorf("Expected done %d, got %d", last+1, done)
+				}
+				last = done
+			})
+			if !ok || err != nil {
+				errs <- fmt.Errorf("Expected true, got %v, %v", ok, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var progress countingProgress
+			summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Workers: 2, Progress: &progress})
+			if err != nil || len(summary.OK) != 2 || progress != 2 {
+				errs <- fmt.Errorf("Expected 2 ok and 2 increments, got %s, %d, %v", summary, progress, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyMemoryBudget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)                                 // Ignore error
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1 MiB
+	sfv := &SFV{Path: filepath.Join(dir, "test.sfv")}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		sfv.Checksums = append(sfv.Checksums, Checksum{
+			Filename: name,
+			Path:     filepath.Join(dir, name),
+			CRC32:    crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)),
+		})
+	}
+
+	const budget = 64 << 10
+	workers, bufSize, err := budgetWorkers(4, budget)
+	if err != nil || workers != 4 || bufSize != 16<<10 {
+		t.Fatalf("Expected 4 workers with 16 KiB each, got %d with %d bytes, %v", workers, bufSize, err)
+	}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{
+		Polynomial:   crc32.Castagnoli,
+		Workers:      4,
+		MemoryBudget: budget,
+		Stats:        &ReadStats{},
+	})
+	if err != nil || len(summary.OK) != 8 {
+		t.Fatalf("Expected 8 ok, got %s, %v", summary, err)
+	}
+	// Each file is read through its worker's buffer, a read per bufSize
+	// bytes and a last one to hit EOF.
+	for _, r := range summary.OK {
+		if expected := int64(len(data)/bufSize + 1); r.Reads != expected {
+			t.Fatalf("Expected %d reads of %s, got %d", expected, r.Filename, r.Reads)
+		}
+	}
+
+	if _, err := sfv.VerifyWithOptions(VerifyOptions{MemoryBudget: MinBufSize - 1}); err == nil {
+		t.Fatal("Expected an error for a budget below MinBufSize")
+	}
+}
+
+func TestBudgetWorkers(t *testing.T) {
+	cases := []struct {
+		workers, budget          int
+		expectedWorkers, bufSize int
+	}{
+		{0, 4096, 1, 4096},
+		{4, 64 << 10, 4, 16 << 10},
+		{16, 2048, 4, 512},
+		{3, 1000, 1, 1000},
+	}
+	for _, c := range cases {
+		workers, bufSize, err := budgetWorkers(c.workers, c.budget)
+		if err != nil || workers != c.expectedWorkers || bufSize != c.bufSize {
+			t.Fatalf("Expected %d workers of %d bytes, got %d, %d, %v", c.expectedWorkers, c.bufSize, workers, bufSize, err)
+		}
+		if workers*bufSize > c.budget {
+			t.Fatalf("Expected at most %d bytes, got %d", c.budget, workers*bufSize)
+		}
+	}
+}
+
+func TestVerifyWithOpener(t *testing.T) {
+	files := map[string]string{
+		"https://example.com/foo": "foo\n",
+		"https://example.com/bar": "baz\n",
+	}
+	open := func(path string) (io.ReadCloser, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+		}
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}
+	sfv := SFV{Checksums: []Checksum{
+		{Filename: "foo", Path: "https://example.com/foo", CRC32: 0x9626347B},
+		{Filename: "bar", Path: "https://example.com/bar", CRC32: 0xFB1D06C8},
+		{Filename: "baz", Path: "https://example.com/baz", CRC32: 0x12345678},
+	}}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Open: open, SkipMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.OK) != 1 || len(summary.Corrupt) != 1 || len(summary.Missing) != 1 {
+		t.Fatalf("Expected 1 ok, 1 missing and 1 corrupt, got %s", summary)
+	}
+	if expected := "foo"; summary.OK[0].Filename != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.OK[0].Filename)
+	}
+}
+
+// slowReader blocks every Read until unblock is closed, like a read from a
+// failing drive.
+type slowReader struct {
+	unblock chan struct{}
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	<-r.unblock
+	return 0, io.EOF
+}
+
+func TestVerifyFileTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	open := func(path string) (io.ReadCloser, error) {
+		if path == "hung" {
+			return ioutil.NopCloser(slowReader{unblock}), nil
+		}
+		return ioutil.NopCloser(strings.NewReader("foo\n")), nil
+	}
+	sfv := SFV{Checksums: []Checksum{
+		{Filename: "hung", Path: "hung", CRC32: 0x9626347B},
+		{Filename: "foo", Path: "foo", CRC32: 0x9626347B},
+	}}
+	start := time.Now()
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Open: open, FileTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the hung file to time out, took %s", elapsed)
+	}
+	if len(summary.OK) != 1 || len(summary.Failed) != 1 {
+		t.Fatalf("Expected 1 ok and 1 failed, got %s", summary)
+	}
+	if !errors.Is(summary.Failed[0].Err, ErrFileTimeout) {
+		t.Fatalf("Expected %v, got %v", ErrFileTimeout, summary.Failed[0].Err)
+	}
+	if expected := "verify hung: timed out verifying file"; summary.Failed[0].Err.Error() != expected {
+		t.Fatalf("Expected %q, got %q", expected, summary.Failed[0].Err.Error())
+	}
+}
+
+func TestLargestFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sfv := &SFV{}
+	for _, f := range []struct {
+		name string
+		size int
+	}{{"small", 1}, {"missing", -1}, {"large", 100}, {"medium", 10}} {
+		p := filepath.Join(dir, f.name)
+		if f.size >= 0 {
+			if err := ioutil.WriteFile(p, make([]byte, f.size), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sfv.Checksums = append(sfv.Checksums, Checksum{Filename: f.name, Path: p})
+	}
+	var names []string
+	for _, c := range largestFirst(sfv.Checksums) {
+		names = append(names, c.Filename)
+	}
+	if expected := []string{"large", "medium", "small", "missing"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+
+	results := 0
+	sfv.VerifyWithOptions(VerifyOptions{ // Ignore error
+		Polynomial:   crc32.Castagnoli,
+		Workers:      2,
+		LargestFirst: true,
+		OnResult:     func(VerifyResult) { results++ },
+	})
+	if results != 4 {
+		t.Fatalf("Expected 4 results, got %d", results)
+	}
+}
+
+// benchmarkSchedule verifies 64 small files followed by one large one, the
+// worst case for manifest order as the large file is read last and alone.
+func benchmarkSchedule(b *testing.B, largestFirst bool) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sfv := &SFV{}
+	for i := 0; i <= 64; i++ {
+		size := 256 << 10
+		if i == 64 {
+			size = 16 << 20
+		}
+		p := filepath.Join(dir, fmt.Sprintf("file%d", i))
+		if err := ioutil.WriteFile(p, make([]byte, size), 0600); err != nil {
+			b.Fatal(err)
+		}
+		sfv.Checksums = append(sfv.Checksums, Checksum{Filename: filepath.Base(p), Path: p})
+	}
+	opts := VerifyOptions{Polynomial: crc32.IEEE, Workers: 4, LargestFirst: largestFirst}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sfv.VerifyWithOptions(opts) // Ignore error
+	}
+}
+
+func BenchmarkScheduleManifestOrder(b *testing.B) { benchmarkSchedule(b, false) }
+
+func BenchmarkScheduleLargestFirst(b *testing.B) { benchmarkSchedule(b, true) }
+
+// emptyReadsReader returns 0, nil for its first empty reads.
+type emptyReadsReader struct {
+	empty int
+	r     io.Reader
+}
+
+func (e *emptyReadsReader) Read(p []byte) (int, error) {
+	if e.empty > 0 {
+		e.empty--
+		return 0, nil
+	}
+	return e.r.Read(p)
+}
+
+func TestVerifyReaderEmptyRead(t *testing.T) {
+	c := Checksum{Filename: "foo", CRC32: 0x9626347b}
+	ok, computed, err := c.VerifyReader(&emptyReadsReader{empty: 1, r: strings.NewReader("foo\n")}, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("Expected data after an empty read to be hashed, computed %X", computed)
+	}
+
+	_, _, err = c.VerifyReader(&emptyReadsReader{empty: maxEmptyReads, r: strings.NewReader("foo\n")}, crc32.Castagnoli)
+	if err != io.ErrNoProgress {
+		t.Fatalf("Expected %v, got %v", io.ErrNoProgress, err)
+	}
+}
+
+func TestVerifyPrefix(t *testing.T) {
+	file, err := tempFile("foo\nbar\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	c := Checksum{Filename: "foobar", Path: file.Name()}
+
+	crc, n, err := c.VerifyPrefix(4, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crc != 0x9626347b || n != 4 {
+		t.Fatalf("Expected 9626347B over 4 bytes, got %X over %d", crc, n)
+	}
+
+	crc, n, err = c.VerifyPrefix(1<<20, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := crc32.Checksum([]byte("foo\nbar\n"), crc32.MakeTable(crc32.Castagnoli)); crc != expected || n != 8 {
+		t.Fatalf("Expected %X over 8 bytes, got %X over %d", expected, crc, n)
+	}
+
+	crc, _, err = c.VerifyPrefix(4, uint32(Auto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := crc32.ChecksumIEEE([]byte("foo\n")); crc != expected {
+		t.Fatalf("Expected Auto to mean IEEE, %X, got %X", expected, crc)
+	}
+}
+
+func TestValidateSelfChecksum(t *testing.T) {
+	f, err := tempFile("foo 9626347B\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	sfv := &SFV{Path: f.Name()}
+	crc, err := sfv.SelfChecksum(crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := crc32.Checksum([]byte("foo 9626347B\n"), crc32.MakeTable(crc32.Castagnoli)); crc != expected {
+		t.Fatalf("Expected %08X, got %08X", expected, crc)
+	}
+	if err := sfv.ValidateSelfChecksum(crc32.Castagnoli); err != nil {
+		t.Fatalf("Expected a manifest without companion file to validate, got %v", err)
+	}
+
+	companion := f.Name() + ".crc"
+	defer os.Remove(companion)
+	for _, content := range []string{fmt.Sprintf("%08X\n", crc), fmt.Sprintf("%s %x\n", filepath.Base(f.Name()), crc)} {
+		if err := ioutil.WriteFile(companion, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := sfv.ValidateSelfChecksum(crc32.Castagnoli); err != nil {
+			t.Fatalf("Expected %q to validate, got %v", content, err)
+		}
+	}
+	if err := ioutil.WriteFile(companion, []byte(fmt.Sprintf("%08X\n", crc+1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := sfv.ValidateSelfChecksum(crc32.Castagnoli); err == nil {
+		t.Fatal("Expected an error for a checksum mismatch")
+	}
+}
+
+func TestTrailerComment(t *testing.T) {
+	for _, line := range []string{"; 2 files, 8 bytes", ";8 bytes in 2 files"} {
+		files, size, ok := parseTrailerComment(line)
+		if !ok || files != 2 || size != 8 {
+			t.Fatalf("Expected 2 files and 8 bytes for %q, got %d %d %v", line, files, size, ok)
+		}
+	}
+	if _, _, ok := parseTrailerComment("; Generated by verifysfv"); ok {
+		t.Fatal("Expected an ordinary comment not to match")
+	}
+
+	f, err := createSFVFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv, err := Read(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, c := range sfv.Checksums {
+			os.Remove(c.Path) // Ignore error
+		}
+		os.Remove(sfv.Path) // Ignore error
+	}()
+	if err := sfv.ValidateTrailer(); err != nil {
+		t.Fatalf("Expected a manifest without trailer to validate, got %v", err)
+	}
+	sfv.ExpectedFileCount, sfv.ExpectedByteCount = 2, 8
+	if err := sfv.ValidateTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	sfv.ExpectedFileCount = 3
+	if err := sfv.ValidateTrailer(); err == nil {
+		t.Fatal("Expected an error for a file count mismatch")
+	}
+	sfv.ExpectedFileCount, sfv.ExpectedByteCount = 2, 9
+	if err := sfv.ValidateTrailer(); err == nil {
+		t.Fatal("Expected an error for a byte count mismatch")
+	}
+
+	parsed, err := ReadFrom(strings.NewReader("foo 1\n; 1 files, 4 bytes\n"), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ExpectedFileCount != 1 || parsed.ExpectedByteCount != 4 {
+		t.Fatalf("Expected trailer totals to be parsed, got %d %d", parsed.ExpectedFileCount, parsed.ExpectedByteCount)
+	}
+}
+
+func TestWalkAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a/foo":      "foo\n",
+		"a/good.sfv": "foo 9626347b\n",
+		"bar":        "bar\n",
+		"bad.sfv":    "bar 00000001\nmissing 00000002\n",
+		"empty.sfv":  "; nothing here\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := WalkAndVerify(dir, crc32.Castagnoli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 reports, got %+v", reports)
+	}
+	expected := map[string]string{
+		filepath.Join(dir, "a", "good.sfv"): "1 ok, 0 missing, 0 corrupt",
+		filepath.Join(dir, "bad.sfv"):       "0 ok, 1 missing, 1 corrupt",
+	}
+	for _, r := range reports {
+		if r.Path == filepath.Join(dir, "empty.sfv") {
+			if r.Err == nil {
+				t.Fatal("Expected an error for an empty SFV")
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Summary.String() != expected[r.Path] {
+			t.Fatalf("Expected %q for %s, got %q", expected[r.Path], r.Path, r.Summary)
+		}
+	}
+}
+
+func TestVerifyAndPromote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	staged := filepath.Join(dir, "file.part")
+	final := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(staged, []byte("foo\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Checksum{Filename: "file", Path: staged, CRC32: 1}
+	if err := VerifyAndPromote(c, final, crc32.Castagnoli); err == nil {
+		t.Fatal("Expected an error for a mismatch")
+	}
+	if _, err := os.Stat(staged); err != nil {
+		t.Fatalf("Expected staged file to be left in place, got %v", err)
+	}
+	if _, err := os.Stat(final); !os.IsNotExist(err) {
+		t.Fatalf("Expected no final file, got %v", err)
+	}
+
+	c.CRC32 = 0x9626347b
+	if err := VerifyAndPromote(c, final, crc32.Castagnoli); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(final); err != nil {
+		t.Fatalf("Expected file to be promoted, got %v", err)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatalf("Expected staged file to be gone, got %v", err)
+	}
+}
+
+func TestSpotChecksRefuseDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // Ignore error
+	c := Checksum{Filename: "dir", Path: dir}
+	if _, _, err := c.VerifyPrefix(1024, crc32.IEEE); !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Expected ErrIsDir from VerifyPrefix, got %v", err)
+	}
+	if _, err := c.VerifyMulti([]uint32{crc32.IEEE}); !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Expected ErrIsDir from VerifyMulti, got %v", err)
+	}
+	if _, err := c.ChunkSums(1024, crc32.IEEE); !errors.Is(err, ErrIsDir) {
+		t.Fatalf("Expected ErrIsDir from ChunkSums, got %v", err)
+	}
+}
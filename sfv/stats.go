@@ -0,0 +1,71 @@
+package verifysfv
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ReadStats collects the number of Read calls made on files and the bytes
+// they returned, to help tune the buffer size empirically: many small reads
+// per file suggest raising SetBufSize. A single ReadStats is shared by all
+// workers of a verification and is safe for concurrent use.
+type ReadStats struct {
+	files, reads, bytes int64 // updated atomically
+}
+
+// Files returns the number of files read.
+func (s *ReadStats) Files() int64 { return atomic.LoadInt64(&s.files) }
+
+// Reads returns the number of Read calls made on the files, which for local
+// files is the number of read syscalls.
+func (s *ReadStats) Reads() int64 { return atomic.LoadInt64(&s.reads) }
+
+// Bytes returns the number of bytes read from the files.
+func (s *ReadStats) Bytes() int64 { return atomic.LoadInt64(&s.bytes) }
+
+// BytesPerRead returns the average number of bytes returned by a Read call,
+// or 0 if nothing has been read.
+func (s *ReadStats) BytesPerRead() float64 {
+	reads := s.Reads()
+	if reads == 0 {
+		return 0
+	}
+	return float64(s.Bytes()) / float64(reads)
+}
+
+// String returns the totals, such as "2 files, 4 reads, 8 bytes (2 bytes per
+// read)".
+func (s *ReadStats) String() string {
+	return fmt.Sprintf("%d files, %d reads, %d bytes (%.0f bytes per read)",
+		s.Files(), s.Reads(), s.Bytes(), s.BytesPerRead())
+}
+
+// add records a file read with the given number of Read calls and bytes.
+func (s *ReadStats) add(reads, bytes int64) {
+	atomic.AddInt64(&s.files, 1)
+	atomic.AddInt64(&s.reads, reads)
+	atomic.AddInt64(&s.bytes, bytes)
+}
+
+// countReads returns r counting its Read calls in reads, or r itself if
+// reads is nil.
+func countReads(r io.Reader, reads *int64) io.Reader {
+	if reads == nil {
+		return r
+	}
+	return &countingReader{r: r, reads: reads}
+}
+
+// countingReader counts the Read calls made on r. The count is updated
+// atomically, as a read abandoned because of VerifyOptions.FileTimeout may
+// still return after the result has been collected.
+type countingReader struct {
+	r     io.Reader
+	reads *int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	atomic.AddInt64(cr.reads, 1)
+	return cr.r.Read(p)
+}
@@ -0,0 +1,55 @@
+package verifysfv
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadStats(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 2000)
+	f, err := tempFile(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name()) // Ignore error
+	sfv := &SFV{Checksums: []Checksum{{
+		Filename: path.Base(f.Name()),
+		Path:     f.Name(),
+		CRC32:    crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)),
+	}}}
+
+	// a single 512 byte buffer takes 4 reads and a fifth to hit EOF
+	stats := &ReadStats{}
+	summary, err := sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli, Stats: stats, MemoryBudget: MinBufSize})
+	if err != nil || len(summary.OK) != 1 {
+		t.Fatalf("Expected 1 ok, got %s, %v", summary, err)
+	}
+	if summary.OK[0].Reads != 5 {
+		t.Fatalf("Expected %d reads, got %d", 5, summary.OK[0].Reads)
+	}
+	if expected := "1 files, 5 reads, 2000 bytes (400 bytes per read)"; stats.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, stats.String())
+	}
+
+	// reads aren't counted without a collector
+	summary, err = sfv.VerifyWithOptions(VerifyOptions{Polynomial: crc32.Castagnoli})
+	if err != nil || len(summary.OK) != 1 {
+		t.Fatalf("Expected 1 ok, got %s, %v", summary, err)
+	}
+	if summary.OK[0].Reads != 0 {
+		t.Fatalf("Expected %d reads, got %d", 0, summary.OK[0].Reads)
+	}
+}
+
+func TestReadStatsEmpty(t *testing.T) {
+	var stats ReadStats
+	if stats.BytesPerRead() != 0 {
+		t.Fatalf("Expected %d, got %f", 0, stats.BytesPerRead())
+	}
+	if expected := "0 files, 0 reads, 0 bytes (0 bytes per read)"; stats.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, stats.String())
+	}
+}
@@ -0,0 +1,175 @@
+package verifysfv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// WriteTo writes s to w in canonical form: a comment header followed by one
+// "filename CRC32" line per checksum, with the CRC32 as 8 uppercase hex
+// digits. The header is s.Header, with "; " prepended to lines that aren't
+// comments already, or a fresh "; Generated by verifysfv" line if s.Header is
+// empty.
+//
+// Checksums using other algorithms are written as md5sum-style
+// "digest  filename" lines without a header, since md5sum and friends don't
+// support comments. Either way, the output can be read back with Read from a
+// file with the matching extension.
+func (s *SFV) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	lines := s.Header
+	if len(lines) == 0 {
+		lines = []string{header}
+	}
+	if s.Algorithm != CRC32 {
+		lines = nil
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, ";") {
+			line = "; " + line
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return cw.n, err
+		}
+	}
+	for _, c := range s.Checksums {
+		if _, err := fmt.Fprintln(bw, c); err != nil {
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes successfully written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// RewriteTo writes original, the content of the SFV file s was read from, to
+// w with the CRC32 of every checksum line replaced by the one in s.Checksums,
+// which must still be in the order they were read. Everything else is kept
+// as written, byte for byte: comments, path separators, line endings and
+// the encoding. The size comments of files whose CRC32 changed are
+// regenerated from the files, as is the byte count of a trailer comment
+// unless some files are missing, so that truncation detection and
+// ValidateTrailer keep working.
+func (s *SFV) RewriteTo(w io.Writer, original []byte) error {
+	if s.Algorithm != CRC32 {
+		return errors.New("only SFV files can be rewritten")
+	}
+	listed, err := ReadFromWithOptions(bytes.NewReader(original), "", ReadOptions{KeepBackslashes: true})
+	if err != nil {
+		return err
+	}
+	if len(listed.Checksums) != len(s.Checksums) {
+		return fmt.Errorf("expected %d checksums in %s, got %d", len(s.Checksums), s.Path, len(listed.Checksums))
+	}
+	changed := map[string]*Checksum{} // by filename as listed
+	for i, c := range listed.Checksums {
+		if s.Checksums[i].CRC32 != c.CRC32 {
+			changed[c.Filename] = &s.Checksums[i]
+		}
+	}
+	var total int64 = -1 // unknown
+	if len(changed) > 0 {
+		if size, err := s.TotalSize(); err == nil {
+			total = size
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	n := 0 // index of the next checksum line
+	for i, line := range splitLines(original) {
+		text := strings.TrimRight(line, "\r\n")
+		eol := line[len(text):]
+		if i == 0 {
+			bom := len(text) - len(strings.TrimPrefix(text, "\uFEFF"))
+			bw.WriteString(text[:bom])
+			text = text[bom:]
+		}
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(trimmed, ";"):
+			text = rewriteComment(text, trimmed, changed, total)
+		case trimmed != "":
+			text = rewriteCRC(text, trimmed, s.Checksums[n].CRC32)
+			n++
+		}
+		bw.WriteString(text)
+		bw.WriteString(eol)
+	}
+	return bw.Flush()
+}
+
+// rewriteCRC returns the checksum line text, trimmed of blanks as trimmed,
+// with its CRC32 field replaced by crc.
+func rewriteCRC(text, trimmed string, crc uint32) string {
+	data := stripInlineComment(trimmed)
+	start := strings.Index(text, trimmed) + strings.LastIndexAny(data, " \t") + 1
+	end := strings.Index(text, trimmed) + len(data)
+	return text[:start] + fmt.Sprintf("%08X", crc) + text[end:]
+}
+
+// rewriteComment returns the comment line text, trimmed of blanks as
+// trimmed, with the size of changed files regenerated from the files, and a
+// trailer's byte count replaced by total if it is known.
+func rewriteComment(text, trimmed string, changed map[string]*Checksum, total int64) string {
+	if filename, _, ok := parseSizeComment(trimmed); ok {
+		c, ok := changed[filename]
+		if !ok {
+			return text
+		}
+		info, err := os.Stat(c.Path)
+		if err != nil {
+			return text
+		}
+		return fmt.Sprintf("; %12d  %s %s", info.Size(), info.ModTime().Format("15:04.05 2006-01-02"), filename)
+	}
+	m := trailerComment.FindStringSubmatchIndex(trimmed)
+	if m == nil || total < 0 {
+		return text
+	}
+	// the byte count is the second group in "N files, M bytes", the third
+	// in "M bytes in N files"
+	start, end := m[4], m[5]
+	if start < 0 {
+		start, end = m[6], m[7]
+	}
+	off := strings.Index(text, trimmed)
+	return text[:off+start] + strconv.FormatInt(total, 10) + text[off+end:]
+}
+
+// splitLines splits b into lines like scanLines, but keeping the "\r\n",
+// "\n" or "\r" ending each line.
+func splitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "\r\n")
+		if i < 0 {
+			lines = append(lines, string(b))
+			break
+		}
+		end := i + 1
+		if b[i] == '\r' && end < len(b) && b[end] == '\n' {
+			end++
+		}
+		lines = append(lines, string(b[:end]))
+		b = b[end:]
+	}
+	return lines
+}
@@ -0,0 +1,187 @@
+package verifysfv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	in := "; made by some other tool\n" +
+		"foo 9626347b\n" +
+		"sub/bar baz FB1D06C8\n" +
+		"short 1\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	n, err := sfv.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "; made by some other tool\n" +
+		"foo 9626347B\n" +
+		"sub/bar baz FB1D06C8\n" +
+		"short 00000001\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.String())
+	}
+	if n != int64(b.Len()) {
+		t.Fatalf("Expected %d bytes written, got %d", b.Len(), n)
+	}
+
+	reread, err := ReadFrom(&b, "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reread.Checksums, sfv.Checksums) {
+		t.Fatalf("Expected %+v, got %+v", sfv.Checksums, reread.Checksums)
+	}
+}
+
+func TestWriteToDigest(t *testing.T) {
+	in := "d3b07384d113edec49eaa6238ad5ff00  foo\n"
+	sfv, err := readFrom(strings.NewReader(in), "/tmp", MD5, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if _, err := sfv.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != in {
+		t.Fatalf("Expected %q, got %q", in, b.String())
+	}
+}
+
+func TestWriteToDigestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // Ignore error
+	in := "d3b07384d113edec49eaa6238ad5ff00  foo\n" +
+		"c157a79031e1c40f85931829bc5fc552  sub/bar\n"
+	sfv, err := readFrom(strings.NewReader(in), dir, MD5, ReadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv.Header = []string{"; made by some other tool"}
+
+	manifest := filepath.Join(dir, "checksums.md5")
+	var b bytes.Buffer
+	if _, err := sfv.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifest, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := Read(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reread.Algorithm != MD5 {
+		t.Fatalf("Expected %v, got %v", MD5, reread.Algorithm)
+	}
+	if !reflect.DeepEqual(reread.Checksums, sfv.Checksums) {
+		t.Fatalf("Expected %+v, got %+v", sfv.Checksums, reread.Checksums)
+	}
+}
+
+func TestWriteToHeader(t *testing.T) {
+	in := "; Generated by cksfv v1.3.14 on 2020-01-02 at 03:04.05\n" +
+		";\n" +
+		";         4  03:04.05 2020-01-02 foo\n" +
+		"foo 9626347B\n" +
+		"; not part of the header\n" +
+		"; 1 files, 4 bytes\n"
+	sfv, err := ReadFrom(strings.NewReader(in), "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []string{"; Generated by cksfv v1.3.14 on 2020-01-02 at 03:04.05", ";"}
+	if !reflect.DeepEqual(sfv.Header, header) {
+		t.Fatalf("Expected %q, got %q", header, sfv.Header)
+	}
+
+	// the header survives a round trip through WriteTo and ReadFrom
+	var b bytes.Buffer
+	if _, err := sfv.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; Generated by cksfv v1.3.14 on 2020-01-02 at 03:04.05\n;\nfoo 9626347B\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.String())
+	}
+	reread, err := ReadFrom(&b, "/tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reread.Header, header) {
+		t.Fatalf("Expected %q, got %q", header, reread.Header)
+	}
+
+	// lines that aren't comments are turned into ones
+	sfv.Header = []string{"edited by hand"}
+	b.Reset()
+	if _, err := sfv.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "; edited by hand\nfoo 9626347B\n"; b.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, b.String())
+	}
+}
+
+func TestRewriteTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gosfv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // Ignore error
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "a"), []byte("foo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "café"), []byte("bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// windows-1252, with backslashes and CRLFs
+	original := []byte("; made by some other tool\r\n" +
+		";           99  12:00.00 2020-01-01 sub\\a\r\n" +
+		";            4  12:00.00 2020-01-01 caf\xe9\r\n" +
+		"sub\\a    00000000 ; stale\r\n" +
+		"caf\xe9 FB1D06C8\r\n" +
+		"; 2 files, 103 bytes\r\n")
+	sfv, err := ReadFromWithOptions(bytes.NewReader(original), dir, ReadOptions{Charset: "windows-1252"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfv.Checksums[0].CRC32 = 0x9626347B
+
+	var b bytes.Buffer
+	if err := sfv.RewriteTo(&b, original); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(b.String(), "\r\n")
+	if filename, size, ok := parseSizeComment(strings.TrimSpace(lines[1])); !ok || filename != "sub\\a" || size != 4 {
+		t.Fatalf("Expected a size comment of 4 bytes for sub\\a, got %q", lines[1])
+	}
+	lines[1] = ""
+	expected := "; made by some other tool\r\n" +
+		";            4  12:00.00 2020-01-01 caf\xe9\r\n" +
+		"sub\\a    9626347B ; stale\r\n" +
+		"caf\xe9 FB1D06C8\r\n" +
+		"; 2 files, 8 bytes\r\n"
+	if got := strings.Join(lines, ""); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// isRotational reports whether the block device holding path is a spinning
+// disk, according to /sys/dev/block. ok is false if it can't be determined,
+// e.g. for network or virtual filesystems.
+func isRotational(path string) (rotational, ok bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false, false
+	}
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	sysDir, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor))
+	if err != nil {
+		return false, false
+	}
+	// partitions don't have a queue directory of their own, their disk does
+	for _, dir := range []string{sysDir, filepath.Dir(sysDir)} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "queue", "rotational"))
+		if err == nil {
+			return strings.TrimSpace(string(b)) == "1", true
+		}
+	}
+	return false, false
+}
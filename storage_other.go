@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// isRotational always reports that the storage type is unknown outside Linux.
+func isRotational(path string) (rotational, ok bool) {
+	return false, false
+}
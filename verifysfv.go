@@ -1,109 +1,1016 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"hash/crc32"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
 	"runtime"
-	"sync"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/cwlbraa/verifysfv/sfv"
 	"github.com/gosuri/uiprogress"
+	"github.com/gosuri/uiprogress/util/strutil"
+	"github.com/mattn/go-isatty"
 )
 
 // command line option configuration
-var poly = flag.String("poly", "crc32c", "crc base polynomial: crc32c (Castagnoli), ieee, or koopman")
+var poly = flag.String("poly", "crc32c", "crc base polynomial: crc32c (Castagnoli), ieee, koopman, a custom polynomial in hex,\n"+
+	"or auto to use the one the manifest expects (ieee for .sfv files)")
 var parallelism = flag.Int("j", runtime.NumCPU(), "# of parallel workers to spin up")
 var memory = flag.Int("mem", runtime.NumCPU()*4, "kBs of memory to use as file buffers")
+var adaptiveMem = flag.Int("adaptive-mem", 0, "size each file's buffer to the file, up to this many kBs per worker, instead of using -mem")
+var format = flag.String("format", "text", "output format: text or json (an array of reports for several manifests)")
+var recursive = flag.Bool("r", false, "verify every .sfv file found under the given directories")
+var list = flag.Bool("list", false, "same as the list command: list entries and whether their files exist without verifying them")
+var failFast = flag.Bool("fail-fast", false, "stop at the first corrupt or missing file")
+var byteProgress = flag.Bool("bytes", false, "show progress in bytes rather than files")
+var skipMissing = flag.Bool("skip-missing", false, "only verify files that exist, e.g. for partial downloads")
+var lenient = flag.Bool("lenient", false, "skip manifest lines that can't be parsed with a warning instead of failing")
+var noColor = flag.Bool("no-color", false, "disable colored output (also disabled by NO_COLOR or when output is not a terminal)")
+var charset = flag.String("charset", "utf-8", "encoding of the manifests: utf-8, windows-1252, or iso-8859-1")
+var sanitize = flag.String("sanitize", "off", "what to do with filenames holding characters Windows doesn't allow, such as ':' or '?':\n"+
+	"off keeps them, replace looks for the files with '_' in their place, reject fails to read the manifest")
+var newerThan = flag.String("newer-than", "", "only verify files modified since a date (2006-01-02 or RFC 3339), or since\n"+
+	"the last successful run with \"last\", which is recorded next to each manifest in a .verified file")
+var largestFirst = flag.Bool("largest-first", false, "verify the largest files first so small files fill in at the end")
+var stdinList = flag.Bool("stdin-list", false, "create a manifest for the newline-delimited paths read from stdin, e.g. from find")
+var out = flag.String("out", "", "also write the report to this file as results come in, so a killed run leaves a partial report.\n"+
+	"json reports are written as one result object per line followed by a summary object")
+var errorsOnly = flag.Bool("errors-only", false, "print only the filenames of corrupt, missing or unreadable files, one per line, e.g. for xargs")
+var limit = flag.String("limit", "", "cap the combined read rate per second, e.g. 50MB or 1GiB, to leave disk bandwidth for other processes")
+var eta = flag.Bool("eta", false, "show the estimated time remaining on the progress bar, based on the bytes left to read")
+var merge = flag.Bool("merge", false, "verify all manifests as one, e.g. every disc of a release found with -r, with a single progress bar")
+var hashOnly = flag.Bool("hash-only", false, "print \"filename CRC32\" with the CRC32 computed for every file in the manifests, or under\n"+
+	"the directories, given, without comparing them against the expected values")
+var cachePath = flag.String("cache", "", "remember the files that verify OK in this file, along with their size and modification time,\n"+
+	"and skip them on later runs until either changes")
+var fileTimeout = flag.Duration("file-timeout", 0, "give up on a file that takes longer than this to verify, e.g. 5m, reporting it as failed\n"+
+	"rather than letting a hung read on a failing drive stall the run")
+var showStats = flag.Bool("stats", false, "print the number of read calls made and the average bytes per read to stderr, e.g. to tune -mem")
+var quiet = flag.Bool("quiet", false, "hide the progress bar (default when output is not a terminal)")
+var file = flag.String("file", "", "verify a single file against the CRC32 given by -crc instead of a manifest")
+var expectedCRC = flag.String("crc", "", "expected CRC32 of -file in hex")
+var storage = flag.String("storage", "auto", "storage type used to pick the # of workers when -j isn't given: hdd, ssd, or auto.\n"+
+	"hdd uses a single worker since parallel reads make a spinning disk seek back and forth,\n"+
+	"ssd uses twice the # of CPUs to keep the drive's queue full, auto detects the type on Linux")
+
+// command is a subcommand of the CLI with its own flag set.
+type command struct {
+	flags *flag.FlagSet
+	usage string
+	run   func(args []string) int // returns the exit code
+}
+
+// commands are the subcommands of the CLI. verify is implied when the first
+// argument isn't the name of a subcommand, e.g. "verifysfv fileManifest.sfv".
+var commands = map[string]*command{}
+
+// subcommand is the flag set of the subcommand being run.
+var subcommand *flag.FlagSet
+
+// dryRun is the -dry-run option of the update command.
+var dryRun *bool
+
+func init() {
+	flag.Var(&excludes, "exclude", "skip files whose name, or base name, matches the glob `pattern`, e.g. '*.log' (repeatable)")
+	verifyFlags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flag.VisitAll(func(f *flag.Flag) {
+		verifyFlags.Var(f.Value, f.Name, f.Usage)
+	})
+	commands["verify"] = &command{
+		flags: verifyFlags,
+		usage: "verify [options] fileManifest.sfv|-...\n" +
+			"       verify [options] -r directory...\n" +
+			"       verify [options] -file data.bin -crc DEADBEEF",
+		run: runVerify,
+	}
+	commands["create"] = &command{
+		flags: sharedFlags("create", "poly", "stdin-list"),
+		usage: "create [options] [directory] > fileManifest.sfv\n" +
+			"       find . -name '*.mkv' | verify create [options] -stdin-list > fileManifest.sfv",
+		run: runCreate,
+	}
+	commands["list"] = &command{
+		flags: sharedFlags("list", "r", "poly", "lenient", "charset", "sanitize"),
+		usage: "list [options] fileManifest.sfv|-...",
+		run:   runList,
+	}
+	updateFlags := sharedFlags("update", "poly", "charset")
+	dryRun = updateFlags.Bool("dry-run", false, "show the entries that would change without rewriting the manifest")
+	commands["update"] = &command{
+		flags: updateFlags,
+		usage: "update [options] fileManifest.sfv [filename...]",
+		run:   runUpdate,
+	}
+	for _, cmd := range commands {
+		cmd := cmd
+		cmd.flags.Usage = func() {
+			fmt.Printf("Usage: verify %s\n\noptions:\n", cmd.usage)
+			cmd.flags.PrintDefaults()
+		}
+	}
+}
+
+// sharedFlags returns a flag set for the subcommand name holding the named
+// top-level flags, so that they can be given before or after the subcommand.
+func sharedFlags(name string, shared ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	for _, n := range shared {
+		f := flag.Lookup(n)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	return fs
+}
 
 func main() {
 	flag.Usage = func() {
 		fmt.Printf("verifysfv: a tiny, fast, almost-always-io-bound tool for verifying sfv files\n\n")
-		fmt.Printf("Usage: verify [options] fileManifest.sfv\n\n")
+		fmt.Printf("Usage: verify [options] [command] [command options] args...\n\n")
+		fmt.Printf("commands:\n")
+		for _, name := range []string{"verify", "create", "list", "update"} {
+			fmt.Printf("  %s\n", strings.ReplaceAll(commands[name].usage, "\n       ", "\n  "))
+		}
+		fmt.Printf("\nverify is the default command. Run verify <command> -h for the options of a command.\n\n")
 		fmt.Printf("options:\n")
 		flag.PrintDefaults()
 	}
-	// parse and verify args
+	// parse the global options, then the subcommand and its options
 	flag.Parse()
-	if len(flag.Args()) < 1 {
-		flag.Usage()
-		os.Exit(1)
+	name, args := "verify", flag.Args()
+	if len(args) > 0 && commands[args[0]] != nil {
+		name, args = args[0], args[1:]
+	} else if *stdinList {
+		name = "create"
+	} else if *list {
+		name = "list"
 	}
-	sfvFilepath := flag.Args()[0]
-	polynomial := parsePoly(*poly)
-	verifysfv.SetBufSize(*memory * 1024 / *parallelism)
+	cmd := commands[name]
+	subcommand = cmd.flags
+	cmd.flags.Parse(args)
+	os.Exit(cmd.run(cmd.flags.Args()))
+}
 
-	// open and parse sfv file
-	parsed, err := verifysfv.Read(sfvFilepath)
+// runCreate prints a manifest for the directory in args, the current
+// directory by default, or for the paths read from stdin with -stdin-list.
+func runCreate(args []string) int {
+	polynomial, err := verifysfv.ParsePolynomial(*poly)
 	if err != nil {
 		log.Fatal(err)
 	}
-	count := len(parsed.Checksums)
+	if *stdinList {
+		if err := verifysfv.CreateFromList(os.Stdin, os.Stdout, polynomial); err != nil {
+			log.Fatal(err)
+		}
+		return 0
+	}
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if err := verifysfv.Create(dir, os.Stdout, polynomial); err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
 
-	// start up progress bar
-	bar := uiprogress.AddBar(count).AppendCompleted().PrependElapsed()
-	uiprogress.Start()
-	// initialize threadsafe data structures
-	checksums := make(chan verifysfv.Checksum, count)
-	errs := make(chan error, count) // nil errors indicate success
-	var wg sync.WaitGroup
-
-	// fire off worker threads
-	for i := 0; i < *parallelism; i++ {
-		wg.Add(1)
-		go func() {
-			for checksum := range checksums {
-				success, result, err := checksum.Verify(polynomial)
-				bar.Incr()
+// runList lists the entries of the manifests in args and whether their files
+// exist, without verifying them.
+func runList(args []string) int {
+	if len(args) < 1 {
+		subcommand.Usage()
+		return 1
+	}
+	polynomial, err := verifysfv.ParsePolynomial(*poly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifests := readManifests(args)
+	warn(manifests, polynomial)
+	exitCode := 0
+	for _, parsed := range manifests {
+		if len(manifests) > 1 {
+			fmt.Printf("==> %s <==\n", parsed.Path)
+		}
+		exitCode |= listEntries(parsed)
+	}
+	return exitCode
+}
 
-				if !success && err == nil {
-					errs <- fmt.Errorf("corruption: expected %x but computed %x for %s\n",
-						checksum.CRC32, result, checksum.Filename)
-					continue
-				}
+// runUpdate recomputes the CRC32s of the files listed in the manifest given
+// as the first argument, or only of the filenames given after it, and
+// rewrites the manifest with the entries that changed.
+func runUpdate(args []string) int {
+	if len(args) < 1 {
+		subcommand.Usage()
+		return 1
+	}
+	polynomial, err := verifysfv.ParsePolynomial(*poly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifest := args[0]
+	if manifest == "-" || strings.HasSuffix(strings.ToLower(manifest), ".gz") {
+		log.Fatalf("can't update %s in place", manifest)
+	}
+	parsed, err := verifysfv.ReadWithOptions(manifest, verifysfv.ReadOptions{Charset: *charset})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if parsed.Algorithm != verifysfv.CRC32 {
+		log.Fatalf("can't update %s: only SFV manifests are supported", manifest)
+	}
+	only := map[string]bool{}
+	for _, filename := range args[1:] {
+		only[filepath.ToSlash(filename)] = true
+	}
 
-				errs <- err // nil error indicates success
-			}
-			wg.Done()
-		}()
+	exitCode := 0
+	changed := 0
+	for i, c := range parsed.Checksums {
+		if len(only) > 0 && !only[c.Filename] {
+			continue
+		}
+		crc, err := c.Compute(polynomial)
+		if err != nil {
+			fmt.Println(colorize(os.Stdout, red, err.Error()))
+			exitCode = 1
+			continue
+		}
+		if crc == c.CRC32 {
+			continue
+		}
+		fmt.Printf("%s: %08X -> %08X\n", c.Filename, c.CRC32, crc)
+		parsed.Checksums[i].CRC32 = crc
+		changed++
+	}
+	if *dryRun {
+		fmt.Printf("%d entries would be updated\n", changed)
+		return exitCode
 	}
+	if changed > 0 {
+		if err := rewrite(parsed); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("%d entries updated\n", changed)
+	return exitCode
+}
 
-	// feed data to worker threads
-	for _, chk := range parsed.Checksums {
-		checksums <- chk
+// rewrite replaces the CRC32s in the manifest at parsed.Path with those in
+// parsed, keeping the rest of the file as written, and writing to a temporary
+// file first so that a failed write doesn't lose the manifest.
+func rewrite(parsed *verifysfv.SFV) error {
+	info, err := os.Stat(parsed.Path)
+	if err != nil {
+		return err
+	}
+	original, err := ioutil.ReadFile(parsed.Path)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(parsed.Path), filepath.Base(parsed.Path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Ignore error, gone after a successful rename
+	if err := parsed.RewriteTo(tmp, original); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), parsed.Path)
+}
+
+// runVerify verifies the manifests in args, or a single file given by -file
+// and -crc.
+func runVerify(args []string) int {
+	if *file != "" || *expectedCRC != "" {
+		return verifyFile(*file, *expectedCRC)
+	}
+	if len(args) < 1 {
+		flag.Usage()
+		return 1
+	}
+	if !isFlagSet("j") {
+		*parallelism = workersForStorage(*storage, storagePath(args))
+	}
+	if *parallelism < 1 {
+		log.Fatalf("invalid number of workers %d", *parallelism)
+	}
+	if err := verifysfv.SetBufSize(*memory * 1024 / *parallelism); err != nil {
+		log.Fatal(err)
+	}
+	if err := verifysfv.SetAdaptiveBufSize(*adaptiveMem * 1024); err != nil {
+		log.Fatal(err)
+	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unsupported format %s", *format)
+	}
+	if *errorsOnly && *format != "text" {
+		log.Fatal("-errors-only only supports the text format")
+	}
+	polynomial, err := verifysfv.ParsePolynomial(*poly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *hashOnly {
+		return printHashes(args, polynomial)
+	}
+	if *limit != "" {
+		rate, err := parseBytes(*limit)
+		if err != nil || rate <= 0 {
+			log.Fatalf("invalid -limit %q", *limit)
+		}
+		limiter = verifysfv.NewLimiter(rate)
+	}
+	if *cachePath != "" {
+		if cache, err = verifysfv.LoadCache(*cachePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *showStats {
+		stats = &verifysfv.ReadStats{}
 	}
-	close(checksums)
+	manifests := readManifests(args)
 
-	// close errs asyncronously so we can print errors as we get them
+	// cancel verification on SIGINT so partial runs abort cleanly
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
 	go func() {
-		wg.Wait()
-		close(errs)
+		<-interrupt
+		cancel()
 	}()
 
-	// detect & print errors
+	warn(manifests, polynomial)
+	if *merge && len(manifests) > 1 {
+		if *newerThan == "last" {
+			log.Fatal("-merge can't be combined with -newer-than last")
+		}
+		merged, err := verifysfv.Merge(manifests...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+		manifests = []*verifysfv.SFV{merged}
+	}
+
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report = f
+	}
+
+	exitCode := 0
+	var total verifysfv.Summary
+	var reports []manifestReport // for -format json
+	for _, parsed := range manifests {
+		if len(manifests) > 1 && *format == "text" && !*errorsOnly {
+			header := fmt.Sprintf("==> %s <==", parsed.Path)
+			fmt.Println(header)
+			reportln(header)
+		}
+		skipped := 0
+		if len(excludes) > 0 {
+			parsed, skipped = excludes.filter(parsed)
+		}
+		if *skipMissing {
+			present := parsed.Existing()
+			skipped += len(parsed.Checksums) - len(present.Checksums)
+			parsed = present
+		}
+		if *newerThan != "" {
+			since := newerThanTime(parsed, *newerThan)
+			changed := parsed.ChangedSince(since)
+			skipped += len(parsed.Checksums) - len(changed.Checksums)
+			parsed = changed
+		}
+		started := time.Now()
+		code, full := verify(ctx, parsed, skipped, polynomial)
+		exitCode |= code
+		reports = append(reports, manifestReport{Manifest: parsed.Path, Report: full})
+		if *newerThan == "last" && code == 0 && ctx.Err() == nil {
+			if err := markVerified(parsed, started); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			}
+		}
+		total.OK = append(total.OK, full.Summary.OK...)
+		total.Missing = append(total.Missing, full.Summary.Missing...)
+		total.Corrupt = append(total.Corrupt, full.Summary.Corrupt...)
+		total.Failed = append(total.Failed, full.Summary.Failed...)
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "verification interrupted")
+			break
+		}
+		if exitCode != 0 && *failFast {
+			break
+		}
+	}
+
+	if *format == "json" {
+		printJSON(reports)
+	}
+	if stats != nil {
+		fmt.Fprintf(os.Stderr, "read stats: %s\n", stats)
+	}
+	if cache != nil {
+		if err := cache.Save(*cachePath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+	if report != nil {
+		if err := report.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// a final line on stderr for scripts, even on success
+	if !*quiet && !*errorsOnly {
+		fmt.Fprintln(os.Stderr, colorize(os.Stderr, statusColor(exitCode), exitSummary(total, exitCode)))
+	}
+	return exitCode
+}
+
+// printHashes prints the CRC32 of every file listed in the manifests in
+// args, or found under the directories in args unless -r is set, as SFV
+// lines, ignoring the expected checksums. Files that can't be read are
+// reported on stderr.
+func printHashes(args []string, polynomial uint32) int {
 	exitCode := 0
-	for err := range errs {
+	var paths []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() && !*recursive {
+			exitCode |= printHashesIn(arg, polynomial)
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) == 0 {
+		return exitCode
+	}
+	for _, parsed := range readManifests(paths) {
+		exitCode |= printChecksums(parsed.Checksums, polynomial)
+	}
+	return exitCode
+}
+
+// printHashesIn prints the CRC32 of every file under dir except sfv files,
+// named relative to dir like verifysfv.Create does, reporting files and
+// directories that can't be read on stderr instead of stopping.
+func printHashesIn(dir string, polynomial uint32) int {
+	exitCode := 0
+	var checksums []verifysfv.Checksum
+	verifysfv.WalkFiles(dir, func(c verifysfv.Checksum, err error) error { // Ignore error
 		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			exitCode = 1
-			fmt.Println(err)
+			return nil
+		}
+		checksums = append(checksums, c)
+		return nil
+	})
+	return exitCode | printChecksums(checksums, polynomial)
+}
+
+// printChecksums prints the CRC32 of every file in checksums as SFV lines,
+// reporting files that can't be read on stderr.
+func printChecksums(checksums []verifysfv.Checksum, polynomial uint32) int {
+	exitCode := 0
+	for _, c := range checksums {
+		crc, err := c.Compute(polynomial)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitCode = 1
+			continue
+		}
+		fmt.Printf("%s %08X\n", c.Filename, crc)
+	}
+	return exitCode
+}
+
+// sanitizeMode parses the -sanitize value.
+func sanitizeMode() verifysfv.Sanitize {
+	switch *sanitize {
+	case "off":
+		return verifysfv.SanitizeOff
+	case "replace":
+		return verifysfv.SanitizeReplace
+	case "reject":
+		return verifysfv.SanitizeReject
+	}
+	log.Fatalf("invalid -sanitize %q", *sanitize)
+	return verifysfv.SanitizeOff
+}
+
+// readManifests opens and parses the sfv files in args, reading from stdin if
+// the path is "-", or every sfv file found under args with -r.
+func readManifests(args []string) []*verifysfv.SFV {
+	readOptions := verifysfv.ReadOptions{Lenient: *lenient, Charset: *charset, Sanitize: sanitizeMode()}
+	var manifests []*verifysfv.SFV
+	if *recursive {
+		for _, root := range args {
+			found, err := verifysfv.FindAll(root)
+			if err != nil {
+				log.Fatal(err)
+			}
+			manifests = append(manifests, found...)
+		}
+		return manifests
+	}
+	for _, sfvFilepath := range expandGlobs(args) {
+		var parsed *verifysfv.SFV
+		var err error
+		if sfvFilepath == "-" {
+			parsed, err = verifysfv.ReadFromWithOptions(os.Stdin, ".", readOptions)
+			if parsed != nil {
+				parsed.Path = "-"
+			}
+		} else {
+			parsed, err = verifysfv.ReadWithOptions(sfvFilepath, readOptions)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		manifests = append(manifests, parsed)
+	}
+	return manifests
+}
+
+// warn prints warnings about problems with the manifests themselves, and
+// removes duplicate entries rather than hashing files twice.
+func warn(manifests []*verifysfv.SFV, polynomial uint32) {
+	for _, parsed := range manifests {
+		for _, w := range parsed.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s: skipped %v\n", parsed.Path, w)
+		}
+		if err := parsed.ValidateTrailer(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", parsed.Path, err)
+		}
+		if err := parsed.ValidateSelfChecksum(polynomial); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", parsed.Path, err)
+		}
+		if err := parsed.Deduplicate(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", parsed.Path, err)
+		}
+	}
+}
+
+// exitSummary returns a one-line account of a whole run, such as
+// "OK: 120 files verified (34.2 GB)" or "FAILED: 120 files checked, 1
+// corrupt, 2 missing (34.2 GB)".
+func exitSummary(total verifysfv.Summary, exitCode int) string {
+	files := len(total.OK) + len(total.Missing) + len(total.Corrupt) + len(total.Failed)
+	if exitCode == 0 {
+		return fmt.Sprintf("OK: %d files verified (%s)", files, formatBytes(total.Bytes()))
+	}
+	line := fmt.Sprintf("FAILED: %d files checked, %d corrupt, %d missing", files, len(total.Corrupt), len(total.Missing))
+	if len(total.Failed) > 0 {
+		line += fmt.Sprintf(", %d failed", len(total.Failed))
+	}
+	return line + fmt.Sprintf(" (%s)", formatBytes(total.Bytes()))
+}
+
+// formatBytes returns n in human readable decimal units, e.g. "34.2 GB".
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// limiter throttles reads to the -limit rate, nil if not set.
+var limiter *verifysfv.Limiter
+
+// cache is loaded from the -cache file, nil if not set.
+var cache *verifysfv.Cache
+
+// stats collects read statistics for -stats, nil if not set.
+var stats *verifysfv.ReadStats
+
+// parseBytes parses a byte count such as "50MB", "1.5G" or "64KiB". Units
+// without an "i" are decimal like formatBytes, a bare number is in bytes.
+func parseBytes(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"k", 1e3}, {"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(n * multiplier), nil
+}
+
+// isFlagSet reports whether the flag called name was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	visit := func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	}
+	flag.Visit(visit)
+	if subcommand != nil {
+		subcommand.Visit(visit)
+	}
+	return set
+}
+
+// storagePath returns a path on the storage holding the files to verify.
+func storagePath(args []string) string {
+	if len(args) == 0 || args[0] == "-" {
+		return "."
+	}
+	return args[0]
+}
+
+// workersForStorage returns the number of workers suited to the storage
+// holding path. Unknown storage keeps the -j default of one worker per CPU.
+func workersForStorage(storage, path string) int {
+	switch storage {
+	case "hdd":
+		return 1
+	case "ssd":
+		return 2 * runtime.NumCPU()
+	case "auto":
+		rotational, ok := isRotational(path)
+		if !ok {
+			return *parallelism
+		}
+		if rotational {
+			return 1
+		}
+		return 2 * runtime.NumCPU()
+	}
+	log.Fatalf("unsupported storage %s", storage)
+	return 0
+}
+
+// ANSI escape codes for colored output.
+const (
+	red   = "\x1b[31m"
+	green = "\x1b[32m"
+	reset = "\x1b[0m"
+)
+
+// colorize wraps s in color if colored output is enabled for f: -no-color and
+// NO_COLOR aren't set and f is a terminal.
+func colorize(f *os.File, color, s string) string {
+	if *noColor || os.Getenv("NO_COLOR") != "" || !isTerminal(f) {
+		return s
+	}
+	return color + s + reset
+}
+
+// statusColor returns green for a successful exit code and red otherwise.
+func statusColor(exitCode int) string {
+	if exitCode == 0 {
+		return green
+	}
+	return red
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// expandGlobs expands glob patterns in args that the shell didn't expand.
+// Arguments that match nothing are kept as-is so that opening them reports a
+// useful error.
+func expandGlobs(args []string) []string {
+	var paths []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			paths = append(paths, arg)
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// newerThanTime parses the -newer-than value for parsed. "last" is the
+// modification time of the manifest's .verified file, or the zero time if it
+// has never been verified.
+func newerThanTime(parsed *verifysfv.SFV, value string) time.Time {
+	if value == "last" {
+		info, err := os.Stat(parsed.Path + ".verified")
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+	log.Fatalf("invalid -newer-than %q", value)
+	return time.Time{}
+}
+
+// markVerified records that parsed was successfully verified at t by setting
+// the modification time of its .verified file, creating it if needed.
+func markVerified(parsed *verifysfv.SFV, t time.Time) error {
+	if parsed.Path == "-" {
+		return nil
+	}
+	sidecar := parsed.Path + ".verified"
+	f, err := os.OpenFile(sidecar, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(sidecar, t, t)
+}
+
+// patterns is a flag.Value collecting the globs given to a repeatable flag.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *patterns) Set(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+// excludes are the -exclude patterns.
+var excludes patterns
+
+// match reports whether filename, or its base name, matches any of p.
+func (p patterns) match(filename string) bool {
+	for _, pattern := range p {
+		if ok, _ := filepath.Match(pattern, filename); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path.Base(filename)); ok {
+			return true
 		}
 	}
+	return false
+}
+
+// filter returns a copy of parsed without the checksums of files matching p
+// along with the number of checksums dropped.
+func (p patterns) filter(parsed *verifysfv.SFV) (*verifysfv.SFV, int) {
+	kept := parsed.Filter(func(c verifysfv.Checksum) bool { return !p.match(c.Filename) })
+	return kept, len(parsed.Checksums) - len(kept.Checksums)
+}
+
+// verify checks every file in parsed using a pool of workers, prints the
+// results and returns the exit code, 0 when all files are correct and 1
+// otherwise, along with the full report. skipped is the number of missing
+// files left out of parsed by -skip-missing.
+func verify(ctx context.Context, parsed *verifysfv.SFV, skipped int, polynomial uint32) (int, *verifysfv.VerifyReport) {
+	count := len(parsed.Checksums)
+	// cancelled on the first failure when -fail-fast is set
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// start up progress bar, keeping stdout clean for json output
+	progress := uiprogress.New()
+	out := os.Stdout
+	if *format == "json" {
+		out = os.Stderr
+		progress.SetOut(out)
+	}
+	showBar := !*quiet && !*errorsOnly && isTerminal(out)
+	total := count
+	// missing files are reported during verification
+	var size int64
+	if *byteProgress || *eta {
+		size, _ = parsed.TotalSize()
+	}
+	if *byteProgress {
+		total = int(size)
+	}
+	start := time.Now()
+	bar := progress.AddBar(total).AppendCompleted()
+	if *byteProgress {
+		// Bar.Set doesn't track elapsed time, so measure it ourselves
+		bar.PrependFunc(func(*uiprogress.Bar) string {
+			return strutil.PadLeft(strutil.PrettyTime(time.Since(start)), 5, ' ')
+		})
+	} else {
+		bar.PrependElapsed()
+	}
+	var read int64 // bytes read so far, shared with the progress bar
+	if *eta {
+		bar.AppendFunc(func(*uiprogress.Bar) string {
+			return "ETA " + estimate(atomic.LoadInt64(&read), size, time.Since(start))
+		})
+	}
+	if showBar {
+		progress.Start()
+	}
+	// verify files in parallel, printing errors as we get them
+	exitCode := 0
+	full := &verifysfv.VerifyReport{Results: []verifysfv.VerifyResult{}, Skipped: skipped}
+	// the only errors are an empty manifest, reported as 0 files, and an
+	// interrupt, handled below
+	parsed.VerifyWithOptions(verifysfv.VerifyOptions{ // Ignore error
+		Polynomial:     polynomial,
+		Context:        ctx,
+		Workers:        *parallelism,
+		FollowSymlinks: true,
+		LargestFirst:   *largestFirst,
+		Limiter:        limiter,
+		Cache:          cache,
+		FileTimeout:    *fileTimeout,
+		Stats:          stats,
+		OnResult: func(r verifysfv.VerifyResult) {
+			if ctx.Err() != nil {
+				return // drain remaining work after an interrupt
+			}
+			atomic.AddInt64(&read, r.Bytes)
+			if *byteProgress {
+				bar.Set(bar.Current() + int(r.Bytes))
+			} else {
+				bar.Incr()
+			}
+			full.Add(r)
+			if *format == "json" {
+				reportJSON(r)
+			}
+			if r.Status() != verifysfv.StatusOK {
+				exitCode = 1
+				if *failFast {
+					cancel()
+				}
+			}
+			if *format != "text" {
+				return
+			}
+			if *errorsOnly {
+				if r.Status() != verifysfv.StatusOK {
+					fmt.Println(r.Filename)
+					reportln(r.Filename)
+				}
+				return
+			}
+			if problem := r.Problem(); problem != "" {
+				fmt.Println(colorize(os.Stdout, red, problem))
+				reportln(problem)
+			}
+		},
+	})
+	if showBar {
+		progress.Stop()
+	}
+	full.Elapsed = time.Since(start)
 
-	os.Exit(exitCode)
+	if ctx.Err() != nil {
+		exitCode = 1
+	}
+	if *format == "json" {
+		// the -out file already has the results, one per line
+		reportJSON(&verifysfv.VerifyReport{Summary: full.Summary, Skipped: full.Skipped, Cached: full.Cached, Elapsed: full.Elapsed})
+	} else if !*errorsOnly {
+		fmt.Println(colorize(os.Stdout, statusColor(exitCode), full.Tally()))
+		fmt.Println(full.Throughput())
+		reportln(full.Tally())
+		reportln(full.Throughput())
+	}
+	return exitCode, full
+}
+
+// manifestReport is the json representation of the report on one of several
+// manifests.
+type manifestReport struct {
+	Manifest string                  `json:"manifest"`
+	Report   *verifysfv.VerifyReport `json:"report"`
+}
+
+// printJSON prints the reports to stdout as a single json document: the
+// report itself for a single manifest, or an array of manifestReports.
+func printJSON(reports []manifestReport) {
+	var v interface{} = reports
+	if len(reports) == 1 {
+		v = reports[0].Report
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func parsePoly(in string) uint32 {
-	switch in {
-	case "crc32c":
-		return crc32.Castagnoli
-	case "ieee":
-		return crc32.IEEE
-	case "koop":
-		return crc32.Koopman
-	default:
-		log.Fatalf("unsupported polynomial %s", in)
+// estimate returns the time left to read total bytes at the average rate
+// so far, or "---" early in a run when too little has been read for the rate
+// to be meaningful.
+func estimate(read, total int64, elapsed time.Duration) string {
+	const minElapsed, minRead = 2 * time.Second, 1 << 20
+	if elapsed < minElapsed || read < minRead {
+		return "---"
 	}
+	if read >= total {
+		return "0s"
+	}
+	left := time.Duration(float64(total-read) / float64(read) * float64(elapsed))
+	return strutil.PrettyTime(left)
+}
+
+// verifyFile checks a single file against an expected CRC32 given in hex,
+// prints the result and returns the exit code.
+func verifyFile(filename, crc string) int {
+	if filename == "" || crc == "" {
+		log.Fatal("-file and -crc must be given together")
+	}
+	polynomial, err := verifysfv.ParsePolynomial(*poly)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expected, err := verifysfv.ParseCRC32(crc)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := verifysfv.Checksum{Filename: filename, Path: filename, CRC32: expected}
+	ok, computed, err := c.Verify(polynomial)
+	if err != nil {
+		fmt.Println(colorize(os.Stdout, red, err.Error()))
+		return 1
+	}
+	if !ok {
+		fmt.Println(colorize(os.Stdout, red, fmt.Sprintf("corruption: expected %08X but computed %08X for %s", c.CRC32, computed, filename)))
+		return 1
+	}
+	fmt.Println(colorize(os.Stdout, green, fmt.Sprintf("ok: %08X %s", computed, filename)))
 	return 0
 }
+
+// listEntries prints every entry in parsed with an EXISTS or MISSING marker
+// and returns 1 if any file is missing, 0 otherwise.
+func listEntries(parsed *verifysfv.SFV) int {
+	exitCode := 0
+	for _, e := range parsed.List() {
+		marker := "EXISTS"
+		if !e.Exists {
+			marker = "MISSING"
+			exitCode = 1
+		}
+		fmt.Printf("%-7s %s %s\n", marker, e.ExpectedHex(), e.Filename)
+	}
+	return exitCode
+}
+
+// report is the -out file, nil if not set. It is written to directly rather
+// than through a buffer so that a killed run leaves everything reported so
+// far.
+var report *os.File
+
+// reportln writes line to the -out file, if any.
+func reportln(line string) {
+	if report != nil {
+		fmt.Fprintln(report, line)
+	}
+}
+
+// reportJSON writes v as a single line of json to the -out file, if any.
+func reportJSON(v interface{}) {
+	if report != nil {
+		json.NewEncoder(report).Encode(v)
+	}
+}